@@ -0,0 +1,558 @@
+package doc
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"path/filepath"
+	"pegasus/parser"
+	"pegasus/scanner"
+	"strings"
+)
+
+// extension of Pegasus source files
+const SOURCE_EXT = ".pgs"
+
+type Format int
+
+const (
+	FORMAT_HTML Format = iota
+	FORMAT_MARKDOWN
+)
+
+// e.g. "html" => FORMAT_HTML
+func ParseFormat(s string) (Format, bool) {
+	switch strings.ToLower(s) {
+	case "html":
+		return FORMAT_HTML, true
+	case "markdown", "md":
+		return FORMAT_MARKDOWN, true
+	default:
+	}
+
+	return FORMAT_HTML, false
+}
+
+type EntryKind int
+
+const (
+	KIND_FUNCTION EntryKind = iota
+	KIND_STRUCT
+	KIND_CLASS
+	KIND_ENUM
+	KIND_VARIANT
+	KIND_VALUE
+)
+
+var kindStrings = [...]string{
+	KIND_FUNCTION: "function",
+	KIND_STRUCT:   "struct",
+	KIND_CLASS:    "class",
+	KIND_ENUM:     "enum",
+	KIND_VARIANT:  "variant",
+	KIND_VALUE:    "value",
+}
+
+func (kind EntryKind) String() string {
+	if kind < 0 || int(kind) >= len(kindStrings) {
+		return ""
+	}
+
+	return kindStrings[kind]
+}
+
+// piece of signature, linked to entry if Target is non-nil
+// (e.g. type name in parameter list)
+type Segment struct {
+	Text   string
+	Target *Entry
+}
+
+type Signature []Segment
+
+// signature without links
+func (sig Signature) String() string {
+	var sb strings.Builder
+
+	for _, seg := range sig {
+		sb.WriteString(seg.Text)
+	}
+
+	return sb.String()
+}
+
+// e.g. field of struct, method of class, member of enum
+type Member struct {
+	Name      string
+	Signature Signature
+	Doc       string
+}
+
+// documented top-level definition
+type Entry struct {
+	Namespace *Namespace
+
+	Kind EntryKind
+	Name string
+	Doc  string
+
+	Signature Signature
+	Members   []Member
+
+	Def parser.IDefinition
+}
+
+// Definitions of one source file, path is taken from file's location
+// relative to root, e.g. geometry/shapes.pgs => geometry::shapes
+type Namespace struct {
+	Path     []string
+	Filename string
+
+	// from //! comments
+	Doc string
+
+	Entries []*Entry
+}
+
+// e.g. geometry::shapes
+func (ns *Namespace) Name() string {
+	return strings.Join(ns.Path, "::")
+}
+
+// entries of given kinds in source order
+func (ns *Namespace) EntriesOf(kinds ...EntryKind) []*Entry {
+	var ret []*Entry
+
+	for _, entry := range ns.Entries {
+		for _, kind := range kinds {
+			if entry.Kind == kind {
+				ret = append(ret, entry)
+				break
+			}
+		}
+	}
+
+	return ret
+}
+
+// all namespaces found below root directory
+type Site struct {
+	Namespaces []*Namespace
+
+	// e.g. "geometry::shapes::Point" => entry
+	entries map[string]*Entry
+}
+
+// Parse every source file below root, errors found while parsing are
+// returned joined together. Files with errors are left out of site,
+// which is only nil if root could not be walked (e.g. ctx was cancelled).
+func Load(ctx context.Context, root string) (*Site, error) {
+	site := &Site{
+		entries: make(map[string]*Entry),
+	}
+
+	var errs []error
+	var files []*parser.File
+
+	walkErr := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if d.IsDir() || filepath.Ext(path) != SOURCE_EXT {
+			return nil
+		}
+
+		f, fileErrs := parseFile(ctx, path)
+
+		// rest of site would be missing
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		errs = append(errs, fileErrs...)
+
+		// unreadable or malformed, rest of site is still documented
+		if f == nil || len(fileErrs) > 0 {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, path)
+
+		if err != nil {
+			return err
+		}
+
+		ns := &Namespace{
+			Path:     namespacePath(rel),
+			Filename: path,
+			Doc:      f.Doc,
+		}
+
+		site.Namespaces = append(site.Namespaces, ns)
+		files = append(files, f)
+
+		return nil
+	})
+
+	if walkErr != nil {
+		errs = append(errs, walkErr)
+
+		return nil, errors.Join(errs...)
+	}
+
+	// all entries are known before signatures are built so that they
+	// may link to definitions in files found later
+
+	for i, ns := range site.Namespaces {
+		for _, def := range files[i].Definitions() {
+			site.addEntry(ns, def)
+		}
+	}
+
+	for _, ns := range site.Namespaces {
+		for _, entry := range ns.Entries {
+			site.describe(entry)
+		}
+	}
+
+	return site, errors.Join(errs...)
+}
+
+// parse single file, returning its errors
+func parseFile(ctx context.Context, path string) (*parser.File, []error) {
+	scan := scanner.NewScanner()
+
+	if err := scan.TokenizeFileContext(ctx, path); err != nil {
+		return nil, []error{err}
+	}
+
+	parse := parser.NewParser(scan)
+
+	parse.ParseContext(ctx)
+
+	var f *parser.File
+
+	for node := range parse.Nodes() {
+		if file, ok := node.(*parser.File); ok {
+			f = file
+		}
+	}
+
+	var errs []error
+
+	for _, diag := range parse.Diagnostics() {
+		if diag.Severity == parser.SEVERITY_ERROR {
+			errs = append(errs, diag.Err)
+		}
+	}
+
+	return f, errs
+}
+
+// e.g. geometry/shapes.pgs => [geometry shapes]
+func namespacePath(rel string) []string {
+	rel = strings.TrimSuffix(filepath.ToSlash(rel), SOURCE_EXT)
+
+	return strings.Split(rel, "/")
+}
+
+func (site *Site) addEntry(ns *Namespace, def parser.IDefinition) {
+	entry := &Entry{
+		Namespace: ns,
+		Name:      def.Name(),
+		Def:       def,
+	}
+
+	switch def := def.(type) {
+	case *parser.Definition:
+		entry.Kind = KIND_VALUE
+		entry.Doc = def.Doc
+	case *parser.FunctionDef:
+		entry.Kind = KIND_FUNCTION
+		entry.Doc = def.Doc
+	case *parser.StructDef:
+		entry.Kind = KIND_STRUCT
+		entry.Doc = def.Doc
+	case *parser.ClassDef:
+		entry.Kind = KIND_CLASS
+		entry.Doc = def.Doc
+	case *parser.EnumDef:
+		entry.Kind = KIND_ENUM
+		entry.Doc = def.Doc
+	case *parser.VariantDef:
+		entry.Kind = KIND_VARIANT
+		entry.Doc = def.Doc
+	default:
+		return
+	}
+
+	ns.Entries = append(ns.Entries, entry)
+
+	site.entries[qualifiedName(ns.Path, entry.Name)] = entry
+}
+
+func qualifiedName(path []string, name string) string {
+	return strings.Join(append(path[:len(path):len(path)], name), "::")
+}
+
+// entry named by IdentExpr's names used in ns, nil if none is found
+// (names are tried relative to ns, then as full path)
+func (site *Site) Resolve(ns *Namespace, names []string) *Entry {
+	if len(names) == 0 {
+		return nil
+	}
+
+	last := len(names) - 1
+
+	path := append(ns.Path[:len(ns.Path):len(ns.Path)], names[:last]...)
+
+	if entry, ok := site.entries[qualifiedName(path, names[last])]; ok {
+		return entry
+	}
+
+	return site.entries[strings.Join(names, "::")]
+}
+
+// fill in signature and members of entry
+func (site *Site) describe(entry *Entry) {
+	ns := entry.Namespace
+
+	var b sigBuilder
+
+	switch def := entry.Def.(type) {
+	case *parser.Definition:
+		b.text(def.Name())
+
+		if def.InferType {
+			b.text(" := ")
+			b.expr(site, ns, def.Value)
+		} else {
+			b.text(" : ")
+			b.expr(site, ns, def.Type)
+			b.text(" = ")
+			b.expr(site, ns, def.Value)
+		}
+	case *parser.FunctionDef:
+		b.function(site, ns, def)
+	case *parser.StructDef:
+		b.text("struct " + def.Name())
+		b.templateParams(site, ns, def.TemplateParams)
+
+		entry.Members = site.fieldMembers(ns, def.Fields)
+	case *parser.ClassDef:
+		b.text("class " + def.Name())
+		b.templateParams(site, ns, def.TemplateParams)
+
+		entry.Members = site.fieldMembers(ns, def.Fields)
+
+		for _, method := range def.Methods {
+			var mb sigBuilder
+
+			mb.function(site, ns, method)
+
+			entry.Members = append(entry.Members, Member{
+				Name:      method.Name(),
+				Signature: mb.sig,
+				Doc:       method.Doc,
+			})
+		}
+	case *parser.EnumDef:
+		b.text("enum " + def.Name())
+
+		for _, member := range def.Members {
+			var mb sigBuilder
+
+			mb.text(member.Name)
+
+			if member.HasValue {
+				mb.text(" = ")
+				mb.expr(site, ns, member.Value)
+			}
+
+			entry.Members = append(entry.Members, Member{
+				Name:      member.Name,
+				Signature: mb.sig,
+				Doc:       member.Doc,
+			})
+		}
+	case *parser.VariantDef:
+		b.text("variant " + def.Name())
+		b.templateParams(site, ns, def.TemplateParams)
+
+		for _, alt := range def.Alternatives {
+			var mb sigBuilder
+
+			mb.text(alt.Name)
+
+			if len(alt.Fields) > 0 {
+				mb.text("(")
+
+				for i, field := range alt.Fields {
+					if i > 0 {
+						mb.text(", ")
+					}
+
+					mb.param(site, ns, &field.Param)
+				}
+
+				mb.text(")")
+			}
+
+			entry.Members = append(entry.Members, Member{
+				Name:      alt.Name,
+				Signature: mb.sig,
+				Doc:       alt.Doc,
+			})
+		}
+	default:
+	}
+
+	entry.Signature = b.sig
+}
+
+func (site *Site) fieldMembers(ns *Namespace, fields []parser.Field) []Member {
+	members := make([]Member, len(fields))
+
+	for i, field := range fields {
+		var b sigBuilder
+
+		b.param(site, ns, &field.Param)
+
+		members[i] = Member{
+			Name:      field.Name,
+			Signature: b.sig,
+			Doc:       field.Doc,
+		}
+	}
+
+	return members
+}
+
+type sigBuilder struct {
+	sig Signature
+}
+
+func (b *sigBuilder) text(s string) {
+	n := len(b.sig)
+
+	// merge with previous unlinked text
+	if n > 0 && b.sig[n-1].Target == nil {
+		b.sig[n-1].Text += s
+		return
+	}
+
+	b.sig = append(b.sig, Segment{Text: s})
+}
+
+// e.g. function dist(a : Point, b : Point) : Float
+func (b *sigBuilder) function(site *Site, ns *Namespace, def *parser.FunctionDef) {
+	b.text("function " + def.Name() + "(")
+
+	for i, param := range def.Params.ParamList {
+		if i > 0 {
+			b.text(", ")
+		}
+
+		b.param(site, ns, &param)
+	}
+
+	b.text(")")
+
+	if def.HasReturnType {
+		b.text(" : ")
+		b.expr(site, ns, def.ReturnType)
+	}
+}
+
+// e.g. [K, N : Integer]
+func (b *sigBuilder) templateParams(site *Site, ns *Namespace, params []parser.TemplateParam) {
+	if len(params) == 0 {
+		return
+	}
+
+	b.text("[")
+
+	for i, param := range params {
+		if i > 0 {
+			b.text(", ")
+		}
+
+		b.text(param.Name)
+
+		if param.HasType {
+			b.text(" : ")
+			b.expr(site, ns, param.Type)
+		}
+	}
+
+	b.text("]")
+}
+
+// e.g. x : Integer = 0 or y := 1
+func (b *sigBuilder) param(site *Site, ns *Namespace, param *parser.Param) {
+	b.text(param.Name)
+
+	if param.InferType {
+		if param.HasDefault {
+			b.text(" := ")
+			b.expr(site, ns, param.Default)
+		}
+
+		return
+	}
+
+	b.text(" : ")
+	b.expr(site, ns, param.Type)
+
+	if param.HasDefault {
+		b.text(" = ")
+		b.expr(site, ns, param.Default)
+	}
+}
+
+// expression in source form where possible, names of documented
+// definitions are linked
+func (b *sigBuilder) expr(site *Site, ns *Namespace, expr parser.IExpr) {
+	switch expr := expr.(type) {
+	case *parser.IdentExpr:
+		target := site.Resolve(ns, expr.Names)
+		text := strings.Join(expr.Names, "::")
+
+		if target == nil {
+			b.text(text)
+			return
+		}
+
+		b.sig = append(b.sig, Segment{Text: text, Target: target})
+	case *parser.FunctionCallExpr:
+		b.expr(site, ns, expr.Function)
+
+		openStr, closeStr := "(", ")"
+
+		if expr.IsTemplateCall {
+			openStr, closeStr = "[", "]"
+		}
+
+		b.text(openStr)
+
+		for i, arg := range expr.Args.ArgList {
+			if i > 0 {
+				b.text(", ")
+			}
+
+			if arg.Name != "" {
+				b.text(arg.Name + " = ")
+			}
+
+			b.expr(site, ns, arg.Value)
+		}
+
+		b.text(closeStr)
+	case *parser.MemberAccessExpr:
+		b.expr(site, ns, expr.Instance)
+		b.text("." + expr.Member)
+	default:
+		b.text(parser.ExprToString(expr))
+	}
+}
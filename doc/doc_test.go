@@ -0,0 +1,239 @@
+package doc
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func writeSources(t *testing.T, files map[string]string) string {
+	root := t.TempDir()
+
+	for name, src := range files {
+		path := filepath.Join(root, filepath.FromSlash(name))
+
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(path, []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return root
+}
+
+var testSources = map[string]string{
+	"geometry/shapes.pgs": `//! Basic shapes.
+
+/// A point in the plane.
+struct Point
+	/// Horizontal position.
+	x : Integer = 0;
+	y : Integer = 0;
+end struct;
+
+/// Distance between two points.
+function dist(a : Point, b : geometry::shapes::Point) : Float
+	return 0.0;
+`,
+	"colors.pgs": `/// Primary colors.
+enum Color
+	Red;
+	/// Also green.
+	Green = 5;
+end enum;
+
+/// Shape to draw with color.
+variant Paint[T]
+	Solid(color : Color, shape : geometry::shapes::Point);
+	None;
+end variant;
+
+not_documented := 1;
+`,
+	"README.txt": "ignored",
+}
+
+func TestLoad(t *testing.T) {
+	site, err := Load(context.Background(), writeSources(t, testSources))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string][]string{
+		"colors": {
+			"enum Color",
+			"variant Paint[T]",
+			"not_documented := 1",
+		},
+		"geometry::shapes": {
+			"struct Point",
+			"function dist(a : Point, b : geometry::shapes::Point) : Float",
+		},
+	}
+
+	if len(site.Namespaces) != len(expected) {
+		t.Fatalf("Expected %d namespaces but got %d", len(expected), len(site.Namespaces))
+	}
+
+	for _, ns := range site.Namespaces {
+		sigs, ok := expected[ns.Name()]
+
+		if !ok || len(sigs) != len(ns.Entries) {
+			t.Errorf("Unexpected namespace %q with %d entries", ns.Name(), len(ns.Entries))
+			continue
+		}
+
+		for i, entry := range ns.Entries {
+			if entry.Signature.String() != sigs[i] {
+				t.Errorf("Expected signature %q but got %q", sigs[i], entry.Signature.String())
+			}
+		}
+	}
+
+	shapes := site.Namespaces[1]
+
+	if shapes.Doc != "Basic shapes." {
+		t.Errorf("Unexpected namespace doc %q", shapes.Doc)
+	}
+
+	point := shapes.Entries[0]
+
+	// both plain and qualified uses of Point are linked to it
+	for _, seg := range shapes.Entries[1].Signature {
+		if strings.Contains(seg.Text, "Point") && seg.Target != point {
+			t.Errorf("Expected %q to link to Point", seg.Text)
+		}
+	}
+
+	if point.Members[0].Doc != "Horizontal position." {
+		t.Errorf("Unexpected member doc %q", point.Members[0].Doc)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	root := writeSources(t, map[string]string{
+		"bad.pgs":  "struct Point x : Integer; end class;",
+		"good.pgs": "/// One.\none := 1;",
+	})
+
+	site, err := Load(context.Background(), root)
+
+	if err == nil {
+		t.Error("Expected error for malformed source")
+	}
+
+	// other files are still documented
+	if site == nil || len(site.Namespaces) != 1 || site.Namespaces[0].Name() != "good" {
+		t.Fatalf("Expected only namespace good in site %v", site)
+	}
+
+	if len(site.Namespaces[0].Entries) != 1 {
+		t.Errorf("Expected 1 entry but got %d", len(site.Namespaces[0].Entries))
+	}
+}
+
+func TestLoadCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancel()
+
+	site, err := Load(ctx, writeSources(t, testSources))
+
+	if site != nil || err == nil {
+		t.Errorf("Expected no site and error once cancelled, got %v", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	site, err := Load(context.Background(), writeSources(t, testSources))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[Format]map[string][]string{
+		FORMAT_HTML: {
+			"index.html": {
+				`<a href="geometry.shapes.html">geometry::shapes</a> &mdash; Basic shapes.`,
+			},
+			"geometry.shapes.html": {
+				`<section id="Point">`,
+				`<p>A point in the plane.</p>`,
+				`<code>function dist(a : <a href="geometry.shapes.html#Point">Point</a>`,
+			},
+			"colors.html": {
+				`<code>variant Paint[T]</code>`,
+				`<code>Solid(color : <a href="colors.html#Color">Color</a>`,
+			},
+		},
+		FORMAT_MARKDOWN: {
+			"index.md": {
+				"- [geometry::shapes](geometry.shapes.md) - Basic shapes.",
+			},
+			"geometry.shapes.md": {
+				"### function dist(a : [Point](geometry.shapes.md#Point)",
+				"- x : Integer = 0: Horizontal position.",
+			},
+			"colors.md": {
+				"### variant Paint\\[T\\]",
+				"- Green = 5: Also green.",
+				"### not\\_documented := 1",
+			},
+		},
+	}
+
+	for format, pages := range expected {
+		outDir := t.TempDir()
+
+		if err := site.Write(outDir, format); err != nil {
+			t.Fatal(err)
+		}
+
+		for name, substrs := range pages {
+			content, err := os.ReadFile(filepath.Join(outDir, name))
+
+			if err != nil {
+				t.Errorf("Failed to read page: %s", err)
+				continue
+			}
+
+			for _, substr := range substrs {
+				if !strings.Contains(string(content), substr) {
+					t.Errorf("Expected %s to contain %q", name, substr)
+				}
+			}
+		}
+	}
+}
+
+func TestWritePageCollisions(t *testing.T) {
+	testSources := []map[string]string{
+		{"index.pgs": "x := 1;"},
+		{"a.b.pgs": "x := 1;", "a/b.pgs": "y := 2;"},
+	}
+
+	for _, sources := range testSources {
+		site, err := Load(context.Background(), writeSources(t, sources))
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		outDir := filepath.Join(t.TempDir(), "out")
+
+		if err := site.Write(outDir, FORMAT_HTML); err == nil {
+			t.Errorf("Expected page collision error for %v", sources)
+		}
+
+		// nothing is written
+		if _, err := os.Stat(outDir); err == nil {
+			t.Errorf("Expected %s not to be created", outDir)
+		}
+	}
+}
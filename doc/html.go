@@ -0,0 +1,140 @@
+package doc
+
+import (
+	"html"
+	"strings"
+)
+
+// inline so that pages need nothing beyond output directory
+const HTML_STYLE = `body { font-family: sans-serif; max-width: 50em; margin: auto; }
+code { font-family: monospace; }
+section { margin-bottom: 1.5em; }
+dd { margin-bottom: 0.5em; }`
+
+type htmlWriter struct{}
+
+func (*htmlWriter) ext() string {
+	return ".html"
+}
+
+func htmlHeader(sb *strings.Builder, title string) {
+	sb.WriteString("<!DOCTYPE html>\n<html>\n<head>\n")
+	sb.WriteString("<meta charset=\"utf-8\">\n")
+	sb.WriteString("<title>" + html.EscapeString(title) + "</title>\n")
+	sb.WriteString("<style>\n" + HTML_STYLE + "\n</style>\n")
+	sb.WriteString("</head>\n<body>\n")
+}
+
+func htmlFooter(sb *strings.Builder) {
+	sb.WriteString("</body>\n</html>\n")
+}
+
+func htmlDoc(sb *strings.Builder, doc string) {
+	for _, para := range paragraphs(doc) {
+		sb.WriteString("<p>" + html.EscapeString(para) + "</p>\n")
+	}
+}
+
+func htmlSignature(sig Signature) string {
+	var sb strings.Builder
+
+	sb.WriteString("<code>")
+
+	for _, seg := range sig {
+		text := html.EscapeString(seg.Text)
+
+		if seg.Target == nil {
+			sb.WriteString(text)
+			continue
+		}
+
+		href := html.EscapeString(entryLink(seg.Target, ".html"))
+
+		sb.WriteString("<a href=\"" + href + "\">" + text + "</a>")
+	}
+
+	sb.WriteString("</code>")
+
+	return sb.String()
+}
+
+func (w *htmlWriter) index(site *Site) string {
+	var sb strings.Builder
+
+	htmlHeader(&sb, "Index")
+
+	sb.WriteString("<h1>Index</h1>\n<ul>\n")
+
+	for _, ns := range site.Namespaces {
+		href := html.EscapeString(pageName(ns, w.ext()))
+
+		sb.WriteString("<li><a href=\"" + href + "\">" +
+			html.EscapeString(ns.Name()) + "</a>")
+
+		if paras := paragraphs(ns.Doc); len(paras) > 0 {
+			sb.WriteString(" &mdash; " + html.EscapeString(paras[0]))
+		}
+
+		sb.WriteString("</li>\n")
+	}
+
+	sb.WriteString("</ul>\n")
+
+	htmlFooter(&sb)
+
+	return sb.String()
+}
+
+func (w *htmlWriter) namespace(ns *Namespace) string {
+	var sb strings.Builder
+
+	htmlHeader(&sb, ns.Name())
+
+	sb.WriteString("<nav><a href=\"index" + w.ext() + "\">Index</a></nav>\n")
+	sb.WriteString("<h1>" + html.EscapeString(ns.Name()) + "</h1>\n")
+
+	htmlDoc(&sb, ns.Doc)
+
+	for _, section := range sections {
+		entries := ns.EntriesOf(section.kinds...)
+
+		if len(entries) == 0 {
+			continue
+		}
+
+		sb.WriteString("<h2>" + section.title + "</h2>\n")
+
+		for _, entry := range entries {
+			id := html.EscapeString(entry.Name)
+
+			sb.WriteString("<section id=\"" + id + "\">\n")
+			sb.WriteString("<h3>" + htmlSignature(entry.Signature) + "</h3>\n")
+
+			htmlDoc(&sb, entry.Doc)
+
+			if len(entry.Members) > 0 {
+				sb.WriteString("<dl>\n")
+
+				for _, member := range entry.Members {
+					sb.WriteString("<dt id=\"" + id + "." +
+						html.EscapeString(member.Name) + "\">" +
+						htmlSignature(member.Signature) + "</dt>\n")
+
+					if member.Doc != "" {
+						sb.WriteString("<dd>\n")
+						htmlDoc(&sb, member.Doc)
+						sb.WriteString("</dd>\n")
+					}
+				}
+
+				sb.WriteString("</dl>\n")
+			}
+
+			sb.WriteString("</section>\n")
+		}
+	}
+
+	htmlFooter(&sb)
+
+	return sb.String()
+}
@@ -0,0 +1,112 @@
+package doc
+
+import (
+	"strings"
+)
+
+type markdownWriter struct{}
+
+func (*markdownWriter) ext() string {
+	return ".md"
+}
+
+// escape characters with meaning in Markdown, e.g. _ in identifiers
+func escapeMarkdown(s string) string {
+	var sb strings.Builder
+
+	for _, r := range s {
+		if strings.ContainsRune("\\`*_[]<>#|", r) {
+			sb.WriteRune('\\')
+		}
+
+		sb.WriteRune(r)
+	}
+
+	return sb.String()
+}
+
+// doc comments are written as is, they may themselves use Markdown
+func markdownDoc(sb *strings.Builder, doc string) {
+	for _, para := range paragraphs(doc) {
+		sb.WriteString(para + "\n\n")
+	}
+}
+
+func markdownSignature(sig Signature) string {
+	var sb strings.Builder
+
+	for _, seg := range sig {
+		text := escapeMarkdown(seg.Text)
+
+		if seg.Target == nil {
+			sb.WriteString(text)
+			continue
+		}
+
+		sb.WriteString("[" + text + "](" + entryLink(seg.Target, ".md") + ")")
+	}
+
+	return sb.String()
+}
+
+func (w *markdownWriter) index(site *Site) string {
+	var sb strings.Builder
+
+	sb.WriteString("# Index\n\n")
+
+	for _, ns := range site.Namespaces {
+		sb.WriteString("- [" + escapeMarkdown(ns.Name()) + "](" +
+			pageName(ns, w.ext()) + ")")
+
+		if paras := paragraphs(ns.Doc); len(paras) > 0 {
+			sb.WriteString(" - " + strings.ReplaceAll(paras[0], "\n", " "))
+		}
+
+		sb.WriteString("\n")
+	}
+
+	return sb.String()
+}
+
+func (w *markdownWriter) namespace(ns *Namespace) string {
+	var sb strings.Builder
+
+	sb.WriteString("[Index](index" + w.ext() + ")\n\n")
+	sb.WriteString("# " + escapeMarkdown(ns.Name()) + "\n\n")
+
+	markdownDoc(&sb, ns.Doc)
+
+	for _, section := range sections {
+		entries := ns.EntriesOf(section.kinds...)
+
+		if len(entries) == 0 {
+			continue
+		}
+
+		sb.WriteString("## " + section.title + "\n\n")
+
+		for _, entry := range entries {
+			// explicit anchor as generated heading ids differ by renderer
+			sb.WriteString("<a id=\"" + entry.Name + "\"></a>\n\n")
+			sb.WriteString("### " + markdownSignature(entry.Signature) + "\n\n")
+
+			markdownDoc(&sb, entry.Doc)
+
+			for _, member := range entry.Members {
+				sb.WriteString("- " + markdownSignature(member.Signature))
+
+				if member.Doc != "" {
+					sb.WriteString(": " + strings.ReplaceAll(member.Doc, "\n", " "))
+				}
+
+				sb.WriteString("\n")
+			}
+
+			if len(entry.Members) > 0 {
+				sb.WriteString("\n")
+			}
+		}
+	}
+
+	return sb.String()
+}
@@ -0,0 +1,115 @@
+package doc
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// entries are grouped into sections on namespace pages in this order
+var sections = []struct {
+	title string
+	kinds []EntryKind
+}{
+	{"Types", []EntryKind{KIND_STRUCT, KIND_CLASS, KIND_VARIANT}},
+	{"Enums", []EntryKind{KIND_ENUM}},
+	{"Functions", []EntryKind{KIND_FUNCTION}},
+	{"Values", []EntryKind{KIND_VALUE}},
+}
+
+// writes page per namespace plus index into outDir (created if needed),
+// nothing is written if two pages would have the same name
+func (site *Site) Write(outDir string, format Format) error {
+	var w pageWriter = &htmlWriter{}
+
+	if format == FORMAT_MARKDOWN {
+		w = &markdownWriter{}
+	}
+
+	index := "index" + w.ext()
+
+	pages := map[string]string{
+		index: w.index(site),
+	}
+
+	// what each page documents, e.g. both a.b.pgs and a/b.pgs would be
+	// written to a.b.html, and index.pgs to the site index
+	owners := map[string]string{
+		index: "site index",
+	}
+
+	for _, ns := range site.Namespaces {
+		name := pageName(ns, w.ext())
+
+		if owner, ok := owners[name]; ok {
+			return fmt.Errorf(
+				"%s: namespace %s would overwrite %s in %s",
+				ns.Filename,
+				ns.Name(),
+				owner,
+				name,
+			)
+		}
+
+		owners[name] = "namespace " + ns.Name()
+		pages[name] = w.namespace(ns)
+	}
+
+	if err := os.MkdirAll(outDir, 0o755); err != nil {
+		return err
+	}
+
+	for name, content := range pages {
+		path := filepath.Join(outDir, name)
+
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+type pageWriter interface {
+	// e.g. ".html"
+	ext() string
+
+	index(site *Site) string
+	namespace(ns *Namespace) string
+}
+
+// e.g. geometry::shapes => geometry.shapes.html
+func pageName(ns *Namespace, ext string) string {
+	return strings.Join(ns.Path, ".") + ext
+}
+
+// link to entry from any page, e.g. geometry.shapes.html#Point
+func entryLink(entry *Entry, ext string) string {
+	return pageName(entry.Namespace, ext) + "#" + entry.Name
+}
+
+// doc comment split on blank lines
+func paragraphs(doc string) []string {
+	var ret []string
+	var lines []string
+
+	for _, line := range strings.Split(doc, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(lines) > 0 {
+				ret = append(ret, strings.Join(lines, "\n"))
+				lines = nil
+			}
+
+			continue
+		}
+
+		lines = append(lines, line)
+	}
+
+	if len(lines) > 0 {
+		ret = append(ret, strings.Join(lines, "\n"))
+	}
+
+	return ret
+}
@@ -0,0 +1,174 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"pegasus/scanner"
+	"unicode/utf8"
+)
+
+type Severity int
+
+const (
+	SEVERITY_ERROR Severity = iota
+	SEVERITY_WARNING
+)
+
+var severityStrings = [...]string{
+	SEVERITY_ERROR:   "error",
+	SEVERITY_WARNING: "warning",
+}
+
+func (severity Severity) String() string {
+	if severity < 0 || int(severity) >= len(severityStrings) {
+		return ""
+	}
+
+	return severityStrings[severity]
+}
+
+type DiagnosticCode int
+
+const (
+	DIAG_UNEXPECTED_TOKEN DiagnosticCode = iota + 1
+	DIAG_EXPECTED_NODE
+	DIAG_MALFORMED_TOKEN
+	DIAG_TOO_MANY_ERRORS
+	DIAG_CANCELLED
+	DIAG_INTEGER_OVERFLOW
+	DIAG_INVALID_ESCAPE
+	DIAG_INPUT_ERROR
+)
+
+// e.g. P0001
+func (code DiagnosticCode) String() string {
+	return fmt.Sprintf("P%04d", int(code))
+}
+
+// reported (once) as last diagnostic when MAX_PARSE_ERRORS is exceeded
+var ErrTooManyErrors = errors.New("too many errors")
+
+// Range of source on single line,
+// EndColumn is column after last character in range
+type SourceRange struct {
+	Line      int
+	Column    int
+	EndColumn int
+}
+
+type Diagnostic struct {
+	Severity Severity
+	Code     DiagnosticCode
+
+	// range where problem was found
+	Primary SourceRange
+
+	// related ranges, e.g. start of construct which was not ended
+	Secondary []SourceRange
+
+	// *ParseError, ErrTooManyErrors, error of cancelled context
+	// or error reading input
+	Err error
+}
+
+func (diag *Diagnostic) Error() string {
+	return diag.Err.Error()
+}
+
+func tokenRange(tok *scanner.Token) SourceRange {
+	width := utf8.RuneCountInString(tok.Text)
+
+	if width == 0 {
+		width = utf8.RuneCountInString(tok.TType.Text())
+	}
+
+	return SourceRange{
+		Line:      tok.Line,
+		Column:    tok.Column,
+		EndColumn: tok.Column + max(width, 1),
+	}
+}
+
+func (err *ParseError) sourceRange() SourceRange {
+	if err.ExpectedNode != nil {
+		line, column := err.ExpectedNode.Position()
+
+		return SourceRange{
+			Line:      line,
+			Column:    column,
+			EndColumn: column + 1,
+		}
+	}
+
+	return tokenRange(&err.Found)
+}
+
+func (parser *Parser) addDiagnostic(severity Severity, err *ParseError) {
+	parser.diagMutex.Lock()
+	defer parser.diagMutex.Unlock()
+
+	if severity == SEVERITY_ERROR {
+		if parser.errCount.Load() >= MAX_PARSE_ERRORS {
+			if !parser.truncated {
+				parser.truncated = true
+
+				parser.diagnostics = append(parser.diagnostics, Diagnostic{
+					Severity: SEVERITY_ERROR,
+					Code:     DIAG_TOO_MANY_ERRORS,
+					Primary:  err.sourceRange(),
+					Err:      ErrTooManyErrors,
+				})
+			}
+
+			return
+		}
+
+		parser.errCount.Add(1)
+	}
+
+	parser.diagnostics = append(parser.diagnostics, Diagnostic{
+		Severity:  severity,
+		Code:      err.Code,
+		Primary:   err.sourceRange(),
+		Secondary: err.Related,
+		Err:       err,
+	})
+}
+
+// parsing ended early due to err (from cancelled context)
+func (parser *Parser) addCancelled(err error) {
+	parser.addStopped(DIAG_CANCELLED, err)
+}
+
+// parsing ended early as input could not be read, e.g. *scanner.FileError
+func (parser *Parser) addInputError(err error) {
+	parser.addStopped(DIAG_INPUT_ERROR, err)
+}
+
+func (parser *Parser) addStopped(code DiagnosticCode, err error) {
+	parser.diagMutex.Lock()
+	defer parser.diagMutex.Unlock()
+
+	tok := parser.scan.Peek()
+
+	parser.errCount.Add(1)
+
+	parser.diagnostics = append(parser.diagnostics, Diagnostic{
+		Severity: SEVERITY_ERROR,
+		Code:     code,
+		Primary:  tokenRange(&tok),
+		Err:      err,
+	})
+}
+
+// returns errors and warnings found so far in order they were found
+func (parser *Parser) Diagnostics() []Diagnostic {
+	parser.diagMutex.Lock()
+	defer parser.diagMutex.Unlock()
+
+	ret := make([]Diagnostic, len(parser.diagnostics))
+
+	copy(ret, parser.diagnostics)
+
+	return ret
+}
@@ -2,9 +2,12 @@ package parser
 
 import (
 	"errors"
-	"log"
+	"fmt"
+	"math/big"
 	"pegasus/scanner"
 	"strconv"
+	"strings"
+	"unicode"
 	"unicode/utf8"
 )
 
@@ -13,25 +16,137 @@ func IntegerLiteralFromTok(tok *scanner.Token) (*IntegerLiteral, error) {
 		return nil, errors.New("expected integer token")
 	}
 
-	value, err := strconv.ParseUint(
-		tok.Text,
-		0,
-		64,
-	)
+	// unprefixed literal is decimal even with leading zeros (e.g. 0755),
+	// prefixed ones are left to SetString, e.g. 0x1F or 0b1_01
+	text, base := strings.ReplaceAll(tok.Text, "_", ""), 10
 
-	if err != nil {
-		log.Printf("Expected integer in \"%s\"", tok.Text)
-		value = 0
+	if len(tok.Text) > 1 && tok.Text[0] == '0' && unicode.IsLetter(rune(tok.Text[1])) {
+		text, base = tok.Text, 0
+	}
+
+	value, ok := new(big.Int).SetString(text, base)
+
+	if !ok {
+		return nil, fmt.Errorf("expected integer in \"%s\"", tok.Text)
 	}
 
 	ret := &IntegerLiteral{
+		Text:  tok.Text,
 		Value: value,
 	}
 	ret.SetPosition(tok.Line, tok.Column)
+	ret.SetSpan(tok.Pos, tok.End())
 
 	return ret, nil
 }
 
+type integerRange struct {
+	min *big.Int
+	max *big.Int
+}
+
+func newIntegerRange(bits uint, signed bool) integerRange {
+	one := big.NewInt(1)
+
+	if signed {
+		limit := new(big.Int).Lsh(one, bits-1)
+
+		return integerRange{
+			min: new(big.Int).Neg(limit),
+			max: new(big.Int).Sub(limit, one),
+		}
+	}
+
+	limit := new(big.Int).Lsh(one, bits)
+
+	return integerRange{
+		min: big.NewInt(0),
+		max: new(big.Int).Sub(limit, one),
+	}
+}
+
+// builtin integer types with fixed ranges
+var integerTypeRanges = map[string]integerRange{
+	"Integer": newIntegerRange(64, true),
+	"Int8":    newIntegerRange(8, true),
+	"Int16":   newIntegerRange(16, true),
+	"Int32":   newIntegerRange(32, true),
+	"Int64":   newIntegerRange(64, true),
+	"UInt8":   newIntegerRange(8, false),
+	"UInt16":  newIntegerRange(16, false),
+	"UInt32":  newIntegerRange(32, false),
+	"UInt64":  newIntegerRange(64, false),
+}
+
+// literal (possibly negated) which expression consists of, and its value
+func integerLiteralValue(value IExpr) (*IntegerLiteral, *big.Int) {
+	switch value := value.(type) {
+	case *IntegerLiteral:
+		return value, value.Value
+	case *UnaryExpr:
+		literal, subValue := integerLiteralValue(value.SubExpr)
+
+		if literal == nil {
+			return nil, nil
+		}
+
+		switch value.Operator.TType {
+		case scanner.TOK_MINUS:
+			return literal, new(big.Int).Neg(subValue)
+		case scanner.TOK_PLUS:
+			return literal, subValue
+		default:
+		}
+	default:
+	}
+
+	return nil, nil
+}
+
+// report error if integer literal value is outside range of builtin
+// integer type it is assigned to, e.g. x : UInt8 = 256
+func (parser *Parser) checkIntegerFits(typeExpr IExpr, value IExpr) {
+	ident, ok := typeExpr.(*IdentExpr)
+
+	if !ok || len(ident.Names) != 1 {
+		return
+	}
+
+	typeRange, ok := integerTypeRanges[ident.Names[0]]
+
+	if !ok {
+		return
+	}
+
+	literal, n := integerLiteralValue(value)
+
+	if literal == nil ||
+		(n.Cmp(typeRange.min) >= 0 && n.Cmp(typeRange.max) <= 0) {
+		return
+	}
+
+	line, column := literal.Position()
+
+	parser.report(SEVERITY_ERROR, &ParseError{
+		Code:     DIAG_INTEGER_OVERFLOW,
+		Expected: scanner.TOK_INTEGER,
+		Found: scanner.Token{
+			TType:  scanner.TOK_INTEGER,
+			Line:   line,
+			Column: column,
+			Width:  len(literal.Text),
+			Text:   literal.Text,
+		},
+		Message: fmt.Sprintf(
+			"integer literal %s overflows %s (range %s to %s)",
+			n,
+			ident.Names[0],
+			typeRange.min,
+			typeRange.max,
+		),
+	})
+}
+
 func FloatLiteralFromTok(tok *scanner.Token) (*FloatLiteral, error) {
 	if tok.TType != scanner.TOK_FLOAT {
 		return nil, errors.New("expected float token")
@@ -43,72 +158,394 @@ func FloatLiteralFromTok(tok *scanner.Token) (*FloatLiteral, error) {
 	)
 
 	if err != nil {
-		log.Printf("Expected float in \"%s\"", tok.Text)
-		value = 0.0
+		return nil, fmt.Errorf("expected float in \"%s\"", tok.Text)
 	}
 
 	ret := &FloatLiteral{
 		Value: value,
 	}
 	ret.SetPosition(tok.Line, tok.Column)
+	ret.SetSpan(tok.Pos, tok.End())
 
 	return ret, nil
 }
 
+// invalid escape sequence in string literal,
+// position is that of backslash which began it
+type EscapeError struct {
+	Line   int
+	Column int
+
+	// escape sequence as written, e.g. \q
+	Text   string
+	Reason string
+}
+
+func (err *EscapeError) Error() string {
+	return err.Reason + ": " + err.Text
+}
+
 func StringLiteralFromTok(tok *scanner.Token) (*StringLiteral, error) {
 	if tok.TType != scanner.TOK_STRING {
 		return nil, errors.New("expected string token")
 	}
 
-	runeCount := utf8.RuneCountInString(tok.Text)
+	textLen := len(tok.Text)
+
+	var text string
+	var err error
 
-	if runeCount < 2 {
-		return nil, errors.New("expected at least two runes to hold quotes")
+	switch {
+	case textLen >= 2 && tok.Text[0] == '`' && tok.Text[textLen-1] == '`':
+		// raw, no escapes
+		text = tok.Text[1 : textLen-1]
+	case textLen >= 2*len(scanner.TRIPLE_QUOTE) &&
+		strings.HasPrefix(tok.Text, scanner.TRIPLE_QUOTE) &&
+		strings.HasSuffix(tok.Text, scanner.TRIPLE_QUOTE):
+		text, err = tripleQuotedString(tok)
+	case textLen >= 2 && tok.Text[0] == '"' && tok.Text[textLen-1] == '"':
+		text, err = unescapeString(tok.Text[1:textLen-1], tok.Line, tok.Column+1)
+	default:
+		return nil, errors.New("expected quote at first and last pos")
 	}
 
-	retIdx := 0
-	retRunes := make([]rune, runeCount)
-	isEscaped := false
+	if err != nil {
+		return nil, err
+	}
 
-	for i, r := range tok.Text {
-		// check for quote at beginning, end
-		if i == 0 || i == runeCount-1 {
-			if r != '"' {
-				return nil, errors.New("expected quote at first and last pos")
-			} else { // found quote as expected
-				continue
-			}
+	ret := &StringLiteral{
+		Text: text,
+	}
+	ret.SetPosition(tok.Line, tok.Column)
+	ret.SetSpan(tok.Pos, tok.End())
+
+	return ret, nil
+}
+
+// Contents of triple-quoted string. Line break after opening quotes is
+// dropped, and indentation common to all non-blank lines (including that
+// of closing quotes if on their own line) is stripped, e.g.
+//
+//	q := """
+//	    SELECT *
+//	      FROM t
+//	    """;
+//
+// gives "SELECT *\n  FROM t\n"
+func tripleQuotedString(tok *scanner.Token) (string, error) {
+	quoteLen := len(scanner.TRIPLE_QUOTE)
+
+	body := tok.Text[quoteLen : len(tok.Text)-quoteLen]
+
+	lines := strings.Split(body, "\n")
+
+	firstLine := tok.Line
+	firstColumn := tok.Column + quoteLen
+
+	if len(lines) > 1 && strings.TrimSpace(lines[0]) == "" {
+		lines = lines[1:]
+
+		firstLine++
+		firstColumn = 1
+	}
+
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+
+	last := len(lines) - 1
+	closingOwnLine := last > 0 && strings.TrimSpace(lines[last]) == ""
+
+	indent := -1
+
+	for i, line := range lines {
+		if strings.TrimSpace(line) == "" && !(closingOwnLine && i == last) {
+			continue
 		}
 
-		if isEscaped {
-			switch r {
-			case 'n': // Line Feed
-				retRunes[retIdx] = '\n'
-			case 't': // Tab
-				retRunes[retIdx] = '\t'
-			case 'r': // Carriage Return
-				retRunes[retIdx] = '\r'
-			case 'v': // Vertical Tab
-				retRunes[retIdx] = '\v'
-			case 'f': // Form Feed
-				retRunes[retIdx] = '\f'
-			default:
-				retRunes[retIdx] = r
-			}
-		} else if r == '\\' {
-			isEscaped = true
-			retIdx-- // will be incremented before next loop
+		lineIndent := len(line) - len(strings.TrimLeft(line, " \t"))
+
+		if indent < 0 || lineIndent < indent {
+			indent = lineIndent
+		}
+	}
+
+	indent = max(indent, 0)
+
+	for i, line := range lines {
+		column := 1
+
+		if i == 0 {
+			column = firstColumn
+		}
+
+		if len(line) >= indent {
+			line = line[indent:]
+			column += indent
 		} else {
-			retRunes[retIdx] = r
+			line = ""
+		}
+
+		unescaped, err := unescapeString(line, firstLine+i, column)
+
+		if err != nil {
+			return "", err
 		}
 
-		retIdx++
+		lines[i] = unescaped
 	}
 
-	ret := &StringLiteral{
-		Text: string(retRunes[:retIdx]),
+	return strings.Join(lines, "\n"), nil
+}
+
+// e.g. 'a', '\n' or '\u{1F600}', which must give exactly one code point
+func CharLiteralFromTok(tok *scanner.Token) (*CharLiteral, error) {
+	if tok.TType != scanner.TOK_CHAR {
+		return nil, errors.New("expected character token")
+	}
+
+	textLen := len(tok.Text)
+
+	if textLen < 2 || tok.Text[0] != '\'' || tok.Text[textLen-1] != '\'' {
+		return nil, errors.New("expected single quote at first and last pos")
+	}
+
+	text, err := unescapeString(tok.Text[1:textLen-1], tok.Line, tok.Column+1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	value, width := utf8.DecodeRuneInString(text)
+
+	if width != len(text) || (value == utf8.RuneError && width <= 1) {
+		return nil, fmt.Errorf(
+			"character literal %s is not exactly one code point",
+			tok.Text,
+		)
+	}
+
+	ret := &CharLiteral{
+		Value: value,
 	}
 	ret.SetPosition(tok.Line, tok.Column)
+	ret.SetSpan(tok.Pos, tok.End())
+
+	return ret, nil
+}
+
+// Literal text of interpolated string between its quotes and embedded
+// expressions, e.g. "Hello, { or }!"
+func StringFragmentFromTok(tok *scanner.Token) (*StringLiteral, error) {
+	switch tok.TType {
+	case scanner.TOK_STRING_START,
+		scanner.TOK_STRING_MIDDLE,
+		scanner.TOK_STRING_END:
+	default:
+		return nil, errors.New("expected interpolated string token")
+	}
+
+	// opening quote or }, then closing quote or {
+	textLen := len(tok.Text)
+
+	if textLen < 2 {
+		return nil, errors.New("expected delimiters at first and last pos")
+	}
+
+	text, err := unescapeString(tok.Text[1:textLen-1], tok.Line, tok.Column+1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	ret := &StringLiteral{
+		Text: text,
+	}
+	ret.SetPosition(tok.Line, tok.Column+1)
+
+	// without delimiters
+	ret.SetSpan(tok.Pos+1, tok.End()-1)
 
 	return ret, nil
 }
+
+// single character escapes, e.g. \n => line feed
+var simpleEscapes = map[rune]rune{
+	'n':  '\n', // Line Feed
+	't':  '\t', // Tab
+	'r':  '\r', // Carriage Return
+	'v':  '\v', // Vertical Tab
+	'f':  '\f', // Form Feed
+	'0':  0,    // Null
+	'\\': '\\',
+	'"':  '"',
+	'\'': '\'',
+
+	// braces would otherwise begin or end embedded expression
+	'{': '{',
+	'}': '}',
+}
+
+// Replace escape sequences in s (string literal without its quotes) which
+// begins at line and column. \xHH gives single byte, so result need not be
+// valid UTF-8, while \u{H...} (1-6 digits) and \UHHHHHHHH give code points.
+func unescapeString(s string, line int, column int) (string, error) {
+	var sb strings.Builder
+
+	sLen := len(s)
+
+	for i := 0; i < sLen; {
+		r, bytes := utf8.DecodeRuneInString(s[i:])
+
+		if r != '\\' {
+			sb.WriteString(s[i : i+bytes])
+
+			if r == '\n' {
+				line++
+				column = 1
+			} else {
+				column++
+			}
+
+			i += bytes
+
+			continue
+		}
+
+		width, err := unescapeOne(&sb, s[i:])
+
+		if err != nil {
+			err.Line = line
+			err.Column = column
+
+			return "", err
+		}
+
+		column += utf8.RuneCountInString(s[i : i+width])
+		i += width
+	}
+
+	return sb.String(), nil
+}
+
+// write value of escape sequence which s begins with,
+// returns its width in bytes
+func unescapeOne(sb *strings.Builder, s string) (int, *EscapeError) {
+	if len(s) < 2 {
+		return len(s), &EscapeError{Text: s, Reason: "incomplete escape sequence"}
+	}
+
+	r, bytes := utf8.DecodeRuneInString(s[1:])
+
+	if value, ok := simpleEscapes[r]; ok {
+		sb.WriteRune(value)
+
+		return 1 + bytes, nil
+	}
+
+	switch r {
+	case 'x':
+		digits, ok := hexDigits(s[2:], 2)
+
+		if !ok {
+			return 0, &EscapeError{
+				Text:   s[:2+len(digits)],
+				Reason: "expected two hex digits in escape sequence",
+			}
+		}
+
+		value, _ := strconv.ParseUint(digits, 16, 8)
+
+		sb.WriteByte(byte(value))
+
+		return 2 + len(digits), nil
+	case 'u':
+		end := strings.IndexByte(s, '}')
+
+		if !strings.HasPrefix(s[2:], "{") || end < 0 {
+			return 0, &EscapeError{
+				Text:   s[:2],
+				Reason: "expected \\u{...} escape sequence",
+			}
+		}
+
+		return end + 1, writeCodePoint(sb, s[:end+1], s[3:end], 6)
+	case 'U':
+		digits, ok := hexDigits(s[2:], 8)
+
+		if !ok {
+			return 0, &EscapeError{
+				Text:   s[:2+len(digits)],
+				Reason: "expected eight hex digits in escape sequence",
+			}
+		}
+
+		return 2 + len(digits), writeCodePoint(sb, s[:2+len(digits)], digits, 8)
+	default:
+	}
+
+	return 0, &EscapeError{
+		Text:   s[:1+bytes],
+		Reason: "unknown escape sequence",
+	}
+}
+
+// first n characters of s if they are hex digits, false if there are fewer
+// (then returned digits are those found)
+func hexDigits(s string, n int) (string, bool) {
+	i := 0
+
+	for i < len(s) && i < n && isHexDigit(s[i]) {
+		i++
+	}
+
+	return s[:i], i == n
+}
+
+func isHexDigit(c byte) bool {
+	return (c >= '0' && c <= '9') ||
+		(c >= 'a' && c <= 'f') ||
+		(c >= 'A' && c <= 'F')
+}
+
+// write code point given by 1 to maxDigits hex digits as UTF-8
+// (text is whole escape sequence)
+func writeCodePoint(sb *strings.Builder, text string, digits string, maxDigits int) *EscapeError {
+	if all, _ := hexDigits(digits, len(digits)); len(digits) == 0 ||
+		len(digits) > maxDigits || all != digits {
+		return &EscapeError{
+			Text:   text,
+			Reason: fmt.Sprintf("expected 1 to %d hex digits in escape sequence", maxDigits),
+		}
+	}
+
+	value, err := strconv.ParseUint(digits, 16, 32)
+
+	if err != nil || value > unicode.MaxRune ||
+		(value >= 0xD800 && value <= 0xDFFF) {
+		return &EscapeError{
+			Text:   text,
+			Reason: "invalid code point in escape sequence",
+		}
+	}
+
+	sb.WriteRune(rune(value))
+
+	return nil
+}
+
+// report invalid escape sequence at its backslash
+func (parser *Parser) invalidEscape(err *EscapeError) {
+	parser.addError(&ParseError{
+		Code:     DIAG_INVALID_ESCAPE,
+		Expected: scanner.TOK_STRING,
+		Found: scanner.Token{
+			TType:  scanner.TOK_STRING,
+			Line:   err.Line,
+			Column: err.Column,
+			Width:  len(err.Text),
+			Text:   err.Text,
+		},
+		Message: err.Error(),
+	})
+}
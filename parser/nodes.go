@@ -1,6 +1,9 @@
 package parser
 
-import "pegasus/scanner"
+import (
+	"math/big"
+	"pegasus/scanner"
+)
 
 type INode interface {
 	nodeTag()
@@ -11,12 +14,19 @@ type INode interface {
 
 	Position() (int, int)
 	SetPosition(int, int)
+
+	// start of first token of node and end of its last one
+	Span() (scanner.Pos, scanner.Pos)
+	SetSpan(scanner.Pos, scanner.Pos)
 }
 
 type Node struct {
 	name   string
 	line   int
 	column int
+
+	start scanner.Pos
+	end   scanner.Pos
 }
 
 func (node *Node) nodeTag() {}
@@ -36,22 +46,174 @@ func (node *Node) SetPosition(line int, column int) {
 	node.line = line
 	node.column = column
 }
+func (node *Node) Span() (scanner.Pos, scanner.Pos) {
+	return node.start, node.end
+}
+func (node *Node) SetSpan(start scanner.Pos, end scanner.Pos) {
+	node.start = start
+	node.end = end
+}
+
+// has span, includes parts of nodes which are not INode themselves
+// (e.g. Param, whose Name field hides Node's Name method)
+type spanner interface {
+	SetSpan(scanner.Pos, scanner.Pos)
+}
 
 type File struct {
 	Node
 
-	definitions []*Definition
+	// from //! comments
+	Doc string
+
+	definitions []IDefinition
 }
 
+// top-level definitions in order they appear in file
+func (f *File) Definitions() []IDefinition {
+	return f.definitions
+}
+
+type IDefinition interface {
+	INode
+
+	definitionTag()
+}
+
+// e.g. x := 5;
 type Definition struct {
 	Node
 
+	// from /// comments preceding definition
+	Doc string
+
 	InferType bool
 
 	Type  IExpr
 	Value IExpr
 }
 
+func (*Definition) definitionTag() {}
+
+// Represents parameter in function definition,
+// e.g. b : Integer = 0
+type Param struct {
+	Node
+
+	Name string
+
+	InferType  bool
+	HasDefault bool
+
+	Type    IExpr
+	Default IExpr
+}
+
+type Params struct {
+	Node
+
+	ParamList []Param
+}
+
+// e.g. function inc(x : Integer) : Integer begin return x + 1; end;
+type FunctionDef struct {
+	Node
+
+	Doc string
+
+	Params Params
+
+	HasReturnType bool
+	ReturnType    IExpr
+
+	Body IStatement
+}
+
+func (*FunctionDef) definitionTag() {}
+
+// e.g. T or N : Integer in struct Array[T, N : Integer]
+type TemplateParam struct {
+	Node
+
+	Name string
+
+	HasType bool
+	Type    IExpr
+}
+
+// Fields share the form of function parameters,
+// e.g. x : Integer = 0;
+type Field struct {
+	Param
+
+	Doc string
+}
+
+// e.g. struct Point x : Integer = 0; y : Integer = 0; end struct;
+type StructDef struct {
+	Node
+
+	Doc string
+
+	TemplateParams []TemplateParam
+	Fields         []Field
+}
+
+func (*StructDef) definitionTag() {}
+
+// struct which may additionally have methods
+type ClassDef struct {
+	StructDef
+
+	Methods []*FunctionDef
+}
+
+// e.g. Green = 5; in enum
+type EnumMember struct {
+	Node
+
+	Doc string
+
+	Name string
+
+	HasValue bool
+	Value    IExpr
+}
+
+// e.g. enum Color Red; Green = 5; Blue; end enum;
+type EnumDef struct {
+	Node
+
+	Doc string
+
+	Members []EnumMember
+}
+
+func (*EnumDef) definitionTag() {}
+
+// Alternative of variant with (possibly empty) payload,
+// e.g. Err(message : String); in variant
+type VariantAlternative struct {
+	Node
+
+	Doc string
+
+	Name   string
+	Fields []Field
+}
+
+// e.g. variant Option[T] Some(value : T); None; end variant;
+type VariantDef struct {
+	Node
+
+	Doc string
+
+	TemplateParams []TemplateParam
+	Alternatives   []VariantAlternative
+}
+
+func (*VariantDef) definitionTag() {}
+
 type IExpr interface {
 	INode
 	exprTag()
@@ -85,7 +247,10 @@ type UnaryExpr struct {
 type IntegerLiteral struct {
 	Expr
 
-	Value uint64
+	// literal as written, e.g. 0xFF
+	Text string
+
+	Value *big.Int
 }
 
 type StringLiteral struct {
@@ -94,6 +259,21 @@ type StringLiteral struct {
 	Text string
 }
 
+// e.g. 'a' or '\u{1F600}'
+type CharLiteral struct {
+	Expr
+
+	Value rune
+}
+
+// e.g. "Hello, {name}!", Parts are *StringLiteral for literal text
+// and embedded expressions in order
+type InterpolatedStringExpr struct {
+	Expr
+
+	Parts []IExpr
+}
+
 type FloatLiteral struct {
 	Expr
 
@@ -141,6 +321,23 @@ type MemberAccessExpr struct {
 	Member   string
 }
 
+// e.g. lambda (a, b) => a < b
+// or lambda (x : Integer) : Integer begin return x * 2; end
+type LambdaExpr struct {
+	Expr
+
+	Params Params
+
+	HasReturnType bool
+	ReturnType    IExpr
+
+	// true => BodyExpr is set instead of Body
+	IsExprBody bool
+
+	BodyExpr IExpr
+	Body     IStatement
+}
+
 type IStatement interface {
 	INode
 
@@ -153,11 +350,31 @@ type Statement struct {
 
 func (*Statement) statementTag() {}
 
+// placeholder for statement which could not be parsed
+type ErrorStatement struct {
+	Statement
+}
+
+// e.g. x := 0;
+type DefinitionStatement struct {
+	Statement
+
+	Def *Definition
+}
+
+// e.g. print(x);
+type ExprStatement struct {
+	Statement
+
+	Expr IExpr
+}
+
 // e.g. x += 10;
 type ModifyVarStatement struct {
 	Statement
 
-	Var      *IdentExpr
+	// variable or member being modified, e.g. x or point.x
+	Var      IExpr
 	Operator scanner.Token
 	Rhs      IExpr
 }
@@ -166,10 +383,18 @@ type ModifyVarStatement struct {
 type IncDecStatement struct {
 	Statement
 
-	Var   *IdentExpr
+	Var   IExpr
 	IsInc bool
 }
 
+// e.g. return x;
+type ReturnStatement struct {
+	Statement
+
+	HasValue bool
+	Value    IExpr
+}
+
 type CompoundStatement struct {
 	Statement
 
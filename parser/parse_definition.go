@@ -0,0 +1,536 @@
+package parser
+
+import (
+	"pegasus/scanner"
+	"strings"
+)
+
+func (parser *Parser) parseDefinition() IDefinition {
+	doc := parser.parseDocComment(scanner.TOK_DOC_COMMENT)
+
+	next := parser.scan.Peek()
+
+	var ret IDefinition
+
+	switch next.TType {
+	case scanner.TOK_STRUCT, scanner.TOK_CLASS:
+		ret = parser.parseTypeDef()
+	case scanner.TOK_ENUM:
+		ret = parser.parseEnumDef()
+	case scanner.TOK_VARIANT:
+		ret = parser.parseVariantDef()
+	case scanner.TOK_FUNCTION:
+		ret = parser.parseFunctionDef()
+	case scanner.TOK_IDENT:
+		def := parser.parseAssignment()
+
+		if def == nil {
+			return nil
+		}
+
+		parser.accept(scanner.TOK_SEMI)
+
+		// span includes semicolon, like those of other definitions
+		parser.setSpan(def, next.Pos)
+
+		ret = def
+	default:
+		return nil
+	}
+
+	switch def := ret.(type) {
+	case *Definition:
+		def.Doc = doc
+	case *FunctionDef:
+		def.Doc = doc
+	case *StructDef:
+		def.Doc = doc
+	case *ClassDef:
+		def.Doc = doc
+	case *EnumDef:
+		def.Doc = doc
+	case *VariantDef:
+		def.Doc = doc
+	default:
+	}
+
+	return ret
+}
+
+// consume consecutive doc comments of type ttype (/// or //!), returning
+// their text without comment markers, e.g. "/// Adds one" => "Adds one"
+func (parser *Parser) parseDocComment(ttype scanner.TokenType) string {
+	var lines []string
+
+	for parser.scan.PeekDocComment().TType == ttype {
+		tok, _ := parser.scan.AdvanceDocComment()
+
+		line := strings.TrimPrefix(tok.Text[len("///"):], " ")
+
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+// e.g. struct Pair[K, V] key : K; value : V; end struct;
+// or class Counter count := 0; function inc() begin end; end class;
+func (parser *Parser) parseTypeDef() IDefinition {
+	tok := parser.scan.Peek()
+
+	if tok.TType != scanner.TOK_STRUCT && tok.TType != scanner.TOK_CLASS {
+		return nil
+	}
+
+	parser.scan.Advance()
+
+	isClass := (tok.TType == scanner.TOK_CLASS)
+
+	var structDef StructDef
+	var classDef ClassDef
+
+	nameTok, err := parser.accept(scanner.TOK_IDENT)
+
+	if err == nil {
+		structDef.name = nameTok.Text
+	}
+
+	if parser.scan.Peek().TType == scanner.TOK_L_BRACK {
+		parser.scan.Advance()
+
+		structDef.TemplateParams = parser.parseTemplateParams()
+
+		parser.accept(scanner.TOK_R_BRACK)
+	}
+
+	for {
+		doc := parser.parseDocComment(scanner.TOK_DOC_COMMENT)
+
+		next := parser.scan.Peek()
+
+		if next.TType == scanner.TOK_END || next.TType == scanner.TOK_EOF {
+			break
+		}
+
+		if next.TType == scanner.TOK_IDENT {
+			var field Field
+
+			field.Param = parser.parseParam(false)
+			field.Doc = doc
+
+			structDef.Fields = append(structDef.Fields, field)
+
+			parser.accept(scanner.TOK_SEMI)
+
+			if parser.panicking {
+				parser.synchronize()
+			}
+
+			continue
+		}
+
+		if isClass && next.TType == scanner.TOK_FUNCTION {
+			method, ok := parser.parseFunctionDef().(*FunctionDef)
+
+			if ok {
+				method.Doc = doc
+				classDef.Methods = append(classDef.Methods, method)
+			}
+
+			if parser.panicking {
+				parser.synchronize()
+			}
+
+			continue
+		}
+
+		if !parser.recoverMember() {
+			break
+		}
+	}
+
+	if isClass {
+		parser.acceptEnd(scanner.TOK_CLASS, &tok)
+
+		classDef.StructDef = structDef
+		classDef.SetPosition(tok.Line, tok.Column)
+		parser.setSpan(&classDef, tok.Pos)
+
+		return &classDef
+	}
+
+	parser.acceptEnd(scanner.TOK_STRUCT, &tok)
+
+	structDef.SetPosition(tok.Line, tok.Column)
+	parser.setSpan(&structDef, tok.Pos)
+
+	return &structDef
+}
+
+// e.g. K, V or N : Integer, stops before closing bracket
+func (parser *Parser) parseTemplateParams() []TemplateParam {
+	var params []TemplateParam
+
+	for {
+		tok := parser.scan.Peek()
+
+		if tok.TType == scanner.TOK_R_BRACK {
+			break
+		}
+
+		nameTok, err := parser.accept(scanner.TOK_IDENT)
+
+		if err != nil {
+			break
+		}
+
+		param := TemplateParam{
+			Name: nameTok.Text,
+		}
+		param.SetPosition(tok.Line, tok.Column)
+
+		if parser.scan.Peek().TType == scanner.TOK_COLON {
+			parser.scan.Advance()
+
+			param.HasType = true
+			param.Type = parser.requireExpr()
+		}
+
+		parser.setSpan(&param, tok.Pos)
+
+		params = append(params, param)
+
+		comma := parser.scan.Peek()
+
+		if comma.TType != scanner.TOK_COMMA {
+			break
+		}
+
+		parser.scan.Advance()
+	}
+
+	return params
+}
+
+// e.g. enum Color Red; Green = 5; Blue; end enum;
+func (parser *Parser) parseEnumDef() IDefinition {
+	tok, err := parser.accept(scanner.TOK_ENUM)
+
+	if err != nil {
+		return nil
+	}
+
+	var ret EnumDef
+	ret.SetPosition(tok.Line, tok.Column)
+
+	nameTok, err := parser.accept(scanner.TOK_IDENT)
+
+	if err == nil {
+		ret.name = nameTok.Text
+	}
+
+	for {
+		doc := parser.parseDocComment(scanner.TOK_DOC_COMMENT)
+
+		next := parser.scan.Peek()
+
+		if next.TType == scanner.TOK_END || next.TType == scanner.TOK_EOF {
+			break
+		}
+
+		if next.TType != scanner.TOK_IDENT {
+			if !parser.recoverMember() {
+				break
+			}
+
+			continue
+		}
+
+		memberTok := parser.scan.Advance()
+
+		member := EnumMember{
+			Doc:  doc,
+			Name: memberTok.Text,
+		}
+		member.SetPosition(memberTok.Line, memberTok.Column)
+
+		if parser.scan.Peek().TType == scanner.TOK_EQ {
+			parser.scan.Advance()
+
+			member.HasValue = true
+			member.Value = parser.requireExpr()
+		}
+
+		parser.setSpan(&member, memberTok.Pos)
+
+		ret.Members = append(ret.Members, member)
+
+		parser.accept(scanner.TOK_SEMI)
+
+		if parser.panicking {
+			parser.synchronize()
+		}
+	}
+
+	parser.acceptEnd(scanner.TOK_ENUM, tok)
+
+	parser.setSpan(&ret, tok.Pos)
+
+	return &ret
+}
+
+// e.g. variant Option[T] Some(value : T); None; end variant;
+func (parser *Parser) parseVariantDef() IDefinition {
+	tok, err := parser.accept(scanner.TOK_VARIANT)
+
+	if err != nil {
+		return nil
+	}
+
+	var ret VariantDef
+	ret.SetPosition(tok.Line, tok.Column)
+
+	nameTok, err := parser.accept(scanner.TOK_IDENT)
+
+	if err == nil {
+		ret.name = nameTok.Text
+	}
+
+	if parser.scan.Peek().TType == scanner.TOK_L_BRACK {
+		parser.scan.Advance()
+
+		ret.TemplateParams = parser.parseTemplateParams()
+
+		parser.accept(scanner.TOK_R_BRACK)
+	}
+
+	for {
+		doc := parser.parseDocComment(scanner.TOK_DOC_COMMENT)
+
+		next := parser.scan.Peek()
+
+		if next.TType == scanner.TOK_END || next.TType == scanner.TOK_EOF {
+			break
+		}
+
+		if next.TType != scanner.TOK_IDENT {
+			if !parser.recoverMember() {
+				break
+			}
+
+			continue
+		}
+
+		altTok := parser.scan.Advance()
+
+		alt := VariantAlternative{
+			Doc:  doc,
+			Name: altTok.Text,
+		}
+		alt.SetPosition(altTok.Line, altTok.Column)
+
+		if parser.scan.Peek().TType == scanner.TOK_L_PAREN {
+			parser.scan.Advance()
+
+			for _, param := range parser.parseParams(false).ParamList {
+				alt.Fields = append(alt.Fields, Field{Param: param})
+			}
+
+			parser.accept(scanner.TOK_R_PAREN)
+		}
+
+		parser.setSpan(&alt, altTok.Pos)
+
+		ret.Alternatives = append(ret.Alternatives, alt)
+
+		parser.accept(scanner.TOK_SEMI)
+
+		if parser.panicking {
+			parser.synchronize()
+		}
+	}
+
+	parser.acceptEnd(scanner.TOK_VARIANT, tok)
+
+	parser.setSpan(&ret, tok.Pos)
+
+	return &ret
+}
+
+// e.g. function inc(x : Integer) : Integer begin return x + 1; end;
+func (parser *Parser) parseFunctionDef() IDefinition {
+	tok, err := parser.accept(scanner.TOK_FUNCTION)
+
+	if err != nil {
+		return nil
+	}
+
+	var ret FunctionDef
+	ret.SetPosition(tok.Line, tok.Column)
+
+	nameTok, err := parser.accept(scanner.TOK_IDENT)
+
+	if err == nil {
+		ret.name = nameTok.Text
+	}
+
+	parser.accept(scanner.TOK_L_PAREN)
+
+	ret.Params = parser.parseParams(false)
+
+	parser.accept(scanner.TOK_R_PAREN)
+
+	if parser.scan.Peek().TType == scanner.TOK_COLON {
+		parser.scan.Advance()
+
+		ret.HasReturnType = true
+		ret.ReturnType = parser.requireExpr()
+	}
+
+	ret.Body = parser.parseStatement()
+
+	if ret.Body == nil {
+		var expected IStatement = &Statement{}
+
+		next := parser.scan.Peek()
+
+		expected.SetPosition(next.Line, next.Column)
+		expected.SetSpan(next.Pos, next.End())
+
+		parser.expectedNode(expected)
+	}
+
+	parser.setSpan(&ret, tok.Pos)
+
+	return &ret
+}
+
+// parameter list of function definition, stops before closing paren
+// (allowUntyped => bare names allowed, e.g. for lambda (a, b))
+func (parser *Parser) parseParams(allowUntyped bool) Params {
+	var params Params
+
+	start := parser.scan.Peek()
+
+	params.SetPosition(start.Line, start.Column)
+
+	for {
+		tok := parser.scan.Peek()
+
+		if tok.TType == scanner.TOK_R_PAREN {
+			break
+		}
+
+		if tok.TType != scanner.TOK_IDENT {
+			parser.accept(scanner.TOK_IDENT)
+			break
+		}
+
+		params.ParamList = append(
+			params.ParamList,
+			parser.parseParam(allowUntyped),
+		)
+
+		comma := parser.scan.Peek()
+
+		if comma.TType != scanner.TOK_COMMA {
+			break
+		}
+
+		parser.scan.Advance()
+	}
+
+	parser.setSpan(&params, start.Pos)
+
+	return params
+}
+
+// e.g. b : Integer = 0 or c := 1
+// (allowUntyped => may also be just name, type is then inferred)
+func (parser *Parser) parseParam(allowUntyped bool) Param {
+	var param Param
+
+	tok := parser.scan.Peek()
+
+	param.SetPosition(tok.Line, tok.Column)
+
+	nameTok, err := parser.accept(scanner.TOK_IDENT)
+
+	if err != nil {
+		param.SetSpan(tok.Pos, tok.Pos)
+
+		return param
+	}
+
+	param.Name = nameTok.Text
+
+	next := parser.scan.Peek()
+
+	if allowUntyped &&
+		(next.TType == scanner.TOK_COMMA || next.TType == scanner.TOK_R_PAREN) {
+		param.InferType = true
+	} else if next.TType == scanner.TOK_COLON_EQ {
+		parser.scan.Advance()
+
+		param.InferType = true
+		param.HasDefault = true
+		param.Default = parser.requireExpr()
+	} else {
+		parser.accept(scanner.TOK_COLON)
+
+		param.Type = parser.requireExpr()
+
+		if parser.scan.Peek().TType == scanner.TOK_EQ {
+			parser.scan.Advance()
+
+			param.HasDefault = true
+			param.Default = parser.requireExpr()
+
+			parser.checkIntegerFits(param.Type, param.Default)
+		}
+	}
+
+	parser.setSpan(&param, tok.Pos)
+
+	return param
+}
+
+func (parser *Parser) parseAssignment() *Definition {
+	next := parser.scan.Peek()
+
+	if next.TType != scanner.TOK_IDENT {
+		return nil
+	}
+
+	parser.scan.Advance()
+
+	start := next
+
+	var ret Definition
+	ret.name = next.Text
+	ret.SetPosition(next.Line, next.Column)
+
+	next = parser.scan.Peek()
+
+	if next.TType == scanner.TOK_COLON {
+		parser.scan.Advance()
+
+		ret.Type = parser.requireExpr()
+
+		parser.accept(scanner.TOK_EQ)
+	} else {
+		ret.InferType = true
+
+		parser.accept(scanner.TOK_COLON_EQ)
+	}
+
+	ret.Value = parser.requireExpr()
+
+	if !ret.InferType {
+		parser.checkIntegerFits(ret.Type, ret.Value)
+	}
+
+	parser.setSpan(&ret, start.Pos)
+
+	return &ret
+}
@@ -0,0 +1,181 @@
+package parser
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiBold   = "\x1b[1m"
+	ansiRed    = "\x1b[1;31m"
+	ansiGreen  = "\x1b[1;32m"
+	ansiYellow = "\x1b[1;33m"
+)
+
+// colour of severity label, e.g. red for "error:"
+var severityColours = [...]string{
+	SEVERITY_ERROR:   ansiRed,
+	SEVERITY_WARNING: ansiYellow,
+}
+
+func (severity Severity) colour() string {
+	if severity < 0 || int(severity) >= len(severityColours) {
+		return ansiBold
+	}
+
+	return severityColours[severity]
+}
+
+// description of node kind for use in error messages
+func nodeDesc(node INode) string {
+	switch node.(type) {
+	case *IdentExpr:
+		return "identifier"
+	case IExpr:
+		return "expression"
+	case IStatement:
+		return "statement"
+	case IDefinition:
+		return "definition"
+	default:
+	}
+
+	return fmt.Sprintf("node of type %T", node)
+}
+
+func (err *ParseError) Position() (int, int) {
+	if err.ExpectedNode != nil {
+		return err.ExpectedNode.Position()
+	}
+
+	return err.Found.Line, err.Found.Column
+}
+
+// e.g. expected Semicolon (';'), found "end"
+func (err *ParseError) summary() string {
+	if err.Message != "" {
+		return err.Message
+	}
+
+	found := err.Found.Text
+
+	if found == "" {
+		found = err.Found.TType.Text()
+	}
+
+	if found == "" {
+		found = err.Found.TType.Desc()
+	} else {
+		found = fmt.Sprintf("%q", found)
+	}
+
+	return "expected " + err.Expected.Desc() + ", found " + found
+}
+
+// line under source line with carets below offending token,
+// tabs are kept so carets line up
+func (err *ParseError) underline() string {
+	_, column := err.Position()
+
+	if err.SourceLine == "" || column < 1 {
+		return ""
+	}
+
+	var sb strings.Builder
+
+	offset := 0
+	runeIdx := 1
+
+	for offset < len(err.SourceLine) && runeIdx < column {
+		r, bytes := utf8.DecodeRuneInString(err.SourceLine[offset:])
+
+		if r == '\t' {
+			sb.WriteRune('\t')
+		} else {
+			sb.WriteRune(' ')
+		}
+
+		offset += bytes
+		runeIdx++
+	}
+
+	width := 1
+
+	if err.ExpectedNode == nil && err.Found.Width > 0 {
+		end := min(offset+err.Found.Width, len(err.SourceLine))
+
+		width = max(1, utf8.RuneCountInString(err.SourceLine[offset:end]))
+	}
+
+	sb.WriteString(strings.Repeat("^", width))
+
+	return sb.String()
+}
+
+// Render error as e.g.
+//
+//	main.pgs:3:9: error: expected Semicolon (';'), found "end"
+//	    x = 5 end
+//	          ^^^
+//
+// labelled with its severity (e.g. "warning:" instead),
+// colour => ANSI escapes are added for display in terminal
+func (err *ParseError) Format(colour bool) string {
+	bold, label, green, reset := "", "", "", ""
+
+	if colour {
+		bold, label, green, reset = ansiBold, err.Severity.colour(), ansiGreen, ansiReset
+	}
+
+	line, column := err.Position()
+
+	location := fmt.Sprintf("%d:%d", line, column)
+
+	if err.Filename != "" {
+		location = err.Filename + ":" + location
+	}
+
+	s := bold + location + ":" + reset + " " +
+		label + err.Severity.String() + ":" + reset + " " +
+		bold + err.summary() + reset
+
+	underline := err.underline()
+
+	if underline != "" {
+		s += "\n" + err.SourceLine + "\n" + green + underline + reset
+	}
+
+	return s
+}
+
+func (err *ParseError) Error() string {
+	return err.Format(false)
+}
+
+// true => writer is terminal and so can display colour
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+
+	if !ok {
+		return false
+	}
+
+	info, statErr := f.Stat()
+
+	if statErr != nil {
+		return false
+	}
+
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// write error followed by newline, in colour if w is terminal
+func WriteError(w io.Writer, err *ParseError) error {
+	_, writeErr := fmt.Fprintln(w, err.Format(isTerminal(w)))
+
+	return writeErr
+}
@@ -1,6 +1,7 @@
 package parser
 
 import (
+	"errors"
 	"pegasus/scanner"
 )
 
@@ -35,6 +36,28 @@ func (parser *Parser) parseExpr() IExpr {
 	return parser.parseBinaryExpr()
 }
 
+// parse expression, adding error and returning placeholder if none is found
+func (parser *Parser) requireExpr() IExpr {
+	ret := parser.parseExpr()
+
+	if ret == nil {
+		var expr IExpr = &ErrorExpr{}
+
+		tok := parser.scan.Peek()
+
+		expr.SetPosition(tok.Line, tok.Column)
+		expr.SetSpan(tok.Pos, tok.Pos)
+
+		// failed to find expression when one was expected
+
+		parser.expectedNode(expr)
+
+		ret = expr
+	}
+
+	return ret
+}
+
 func (parser *Parser) parseBinaryExpr() IExpr {
 	return parser.parseBinaryExprPrec(0)
 }
@@ -55,6 +78,9 @@ func (parser *Parser) parseBinaryExprPrec(prec int) IExpr {
 		return parser.parseBinaryExprPrec(prec + 1)
 	}
 
+	// span of operand excludes any parentheses around it, e.g. (1 + 2) * 3
+	start := parser.scan.Peek().Pos
+
 	expr := parseNext()
 
 	if expr == nil {
@@ -86,6 +112,7 @@ func (parser *Parser) parseBinaryExprPrec(prec int) IExpr {
 			Rhs:      parseNext(),
 		}
 		expr.SetPosition(line, column)
+		parser.setSpan(expr, start)
 	}
 
 	return expr
@@ -96,6 +123,13 @@ func (parser *Parser) parseUnaryExpr() IExpr {
 	foundOp := false
 	nextTok := parser.scan.Peek()
 
+	// "++" and "--" only modify variables in statements, so in front of an
+	// expression they are two unary operators, e.g. ++5 => (+ (+ 5))
+	if nextTok.TType == scanner.TOK_PLUS_PLUS ||
+		nextTok.TType == scanner.TOK_MINUS_MINUS {
+		return parser.parseDoubledUnaryExpr()
+	}
+
 	for _, op := range unaryOps {
 		if nextTok.TType == op {
 			foundOp = true
@@ -117,12 +151,54 @@ func (parser *Parser) parseUnaryExpr() IExpr {
 		SubExpr:  subExpr,
 	}
 	ret.SetPosition(nextTok.Line, nextTok.Column)
+	parser.setSpan(ret, nextTok.Pos)
+
+	return ret
+}
+
+func (parser *Parser) parseDoubledUnaryExpr() IExpr {
+	nextTok := parser.scan.Advance()
+
+	opType := scanner.TOK_PLUS
+
+	if nextTok.TType == scanner.TOK_MINUS_MINUS {
+		opType = scanner.TOK_MINUS
+	}
+
+	outerOp := scanner.Token{
+		TType:  opType,
+		Line:   nextTok.Line,
+		Column: nextTok.Column,
+		Width:  1,
+		Text:   opType.Text(),
+		Pos:    nextTok.Pos,
+	}
+	innerOp := outerOp
+	innerOp.Column++
+	innerOp.Pos++
+
+	inner := &UnaryExpr{
+		Operator: innerOp,
+		SubExpr:  parser.parseUnaryExpr(),
+	}
+	inner.SetPosition(innerOp.Line, innerOp.Column)
+	parser.setSpan(inner, innerOp.Pos)
+
+	ret := &UnaryExpr{
+		Operator: outerOp,
+		SubExpr:  inner,
+	}
+	ret.SetPosition(outerOp.Line, outerOp.Column)
+	parser.setSpan(ret, outerOp.Pos)
 
 	return ret
 }
 
 // e.g. function call, member access
 func (parser *Parser) parsePostfixExpr() IExpr {
+	// e.g. start of (a).b is (
+	start := parser.scan.Peek().Pos
+
 	ret := parser.parsePrimaryExpr()
 
 	if ret == nil {
@@ -150,9 +226,9 @@ func (parser *Parser) parsePostfixExpr() IExpr {
 			ret.SetPosition(line, column)
 
 			if isTemplateCall {
-				parser.accept(scanner.TOK_R_BRACK)
+				parser.acceptRelated(scanner.TOK_R_BRACK, tokenRange(&nextTok))
 			} else {
-				parser.accept(scanner.TOK_R_PAREN)
+				parser.acceptRelated(scanner.TOK_R_PAREN, tokenRange(&nextTok))
 			}
 		case scanner.TOK_PERIOD: // Member Access
 			parser.scan.Advance()
@@ -180,6 +256,8 @@ func (parser *Parser) parsePostfixExpr() IExpr {
 		if noPostfixOp {
 			break
 		}
+
+		parser.setSpan(ret, start)
 	}
 
 	return ret
@@ -195,9 +273,9 @@ func (parser *Parser) parsePrimaryExpr() IExpr {
 	case scanner.TOK_L_PAREN:
 		parser.scan.Advance()
 
-		ret = parser.parseExpr()
+		ret = parser.requireExpr()
 
-		parser.accept(scanner.TOK_R_PAREN)
+		parser.acceptRelated(scanner.TOK_R_PAREN, tokenRange(&nextTok))
 	case scanner.TOK_INTEGER:
 		ret, err = IntegerLiteralFromTok(&nextTok)
 		parser.scan.Advance()
@@ -207,14 +285,32 @@ func (parser *Parser) parsePrimaryExpr() IExpr {
 	case scanner.TOK_STRING:
 		ret, err = StringLiteralFromTok(&nextTok)
 		parser.scan.Advance()
+	case scanner.TOK_CHAR:
+		ret, err = CharLiteralFromTok(&nextTok)
+		parser.scan.Advance()
+	case scanner.TOK_STRING_START:
+		ret = parser.parseInterpolatedStringExpr()
 	case scanner.TOK_IDENT:
 		ret = parser.parseIdentExpr()
+	case scanner.TOK_LAMBDA:
+		ret = parser.parseLambdaExpr()
+	case scanner.TOK_FAILURE:
+		// scanner found malformed token, e.g. 0x
+		err = errors.New("invalid token")
+		parser.scan.Advance()
 	default:
 		return nil
 	}
 
 	if err != nil {
-		parser.malformed(&nextTok)
+		var escapeErr *EscapeError
+
+		if errors.As(err, &escapeErr) {
+			parser.invalidEscape(escapeErr)
+		} else {
+			parser.malformed(&nextTok)
+		}
+
 		ret = &ErrorExpr{}
 	}
 
@@ -222,6 +318,7 @@ func (parser *Parser) parsePrimaryExpr() IExpr {
 		// => should set position
 
 		ret.SetPosition(nextTok.Line, nextTok.Column)
+		parser.setSpan(ret, nextTok.Pos)
 	}
 
 	return ret
@@ -261,3 +358,95 @@ func (parser *Parser) parseIdentExpr() IExpr {
 
 	return ret
 }
+
+// e.g. lambda (a, b) => a < b
+// or lambda (x : Integer) : Integer begin return x * 2; end
+func (parser *Parser) parseLambdaExpr() IExpr {
+	tok, err := parser.accept(scanner.TOK_LAMBDA)
+
+	if err != nil {
+		return nil
+	}
+
+	ret := &LambdaExpr{}
+	ret.SetPosition(tok.Line, tok.Column)
+
+	parser.accept(scanner.TOK_L_PAREN)
+
+	ret.Params = parser.parseParams(true)
+
+	parser.accept(scanner.TOK_R_PAREN)
+
+	if parser.scan.Peek().TType == scanner.TOK_COLON {
+		parser.scan.Advance()
+
+		ret.HasReturnType = true
+		ret.ReturnType = parser.requireExpr()
+	}
+
+	if parser.scan.Peek().TType == scanner.TOK_BEGIN {
+		ret.Body = parser.parseCompoundStatement()
+
+		return ret
+	}
+
+	parser.accept(scanner.TOK_EQ_GT)
+
+	ret.IsExprBody = true
+	ret.BodyExpr = parser.requireExpr()
+
+	return ret
+}
+
+// e.g. "Hello, {name}!" => (interp "Hello, " name "!")
+func (parser *Parser) parseInterpolatedStringExpr() IExpr {
+	tok, err := parser.accept(scanner.TOK_STRING_START)
+
+	if err != nil {
+		return nil
+	}
+
+	ret := &InterpolatedStringExpr{}
+	ret.SetPosition(tok.Line, tok.Column)
+
+	fragment := *tok
+
+	for {
+		literal, err := StringFragmentFromTok(&fragment)
+
+		var escapeErr *EscapeError
+
+		if errors.As(err, &escapeErr) {
+			parser.invalidEscape(escapeErr)
+		} else if err == nil && literal.Text != "" {
+			ret.Parts = append(ret.Parts, literal)
+		}
+
+		if fragment.TType == scanner.TOK_STRING_END {
+			break
+		}
+
+		ret.Parts = append(ret.Parts, parser.requireExpr())
+
+		next := parser.scan.Peek()
+
+		if next.TType != scanner.TOK_STRING_MIDDLE {
+			endTok, err := parser.acceptRelated(
+				scanner.TOK_STRING_END,
+				tokenRange(tok),
+			)
+
+			if err != nil {
+				break
+			}
+
+			fragment = *endTok
+
+			continue
+		}
+
+		fragment = parser.scan.Advance()
+	}
+
+	return ret
+}
@@ -1,5 +1,399 @@
 package parser
 
+import (
+	"pegasus/scanner"
+)
+
+// operators which may follow variable in ModifyVarStatement
+var modifyOps []scanner.TokenType = []scanner.TokenType{
+	scanner.TOK_EQ,
+	scanner.TOK_PLUS_EQ,
+	scanner.TOK_MINUS_EQ,
+	scanner.TOK_STAR_EQ,
+	scanner.TOK_STAR_STAR_EQ,
+	scanner.TOK_F_SLASH_EQ,
+	scanner.TOK_PERCENT_EQ,
+	scanner.TOK_AMPERSAND_EQ,
+	scanner.TOK_CARROT_EQ,
+	scanner.TOK_PIPE_EQ,
+	scanner.TOK_LT_LT_EQ,
+	scanner.TOK_GT_GT_EQ,
+}
+
 func (parser *Parser) parseStatement() IStatement {
-	return nil
+	next := parser.scan.Peek()
+
+	// spans of statements include their semicolons
+
+	switch next.TType {
+	case scanner.TOK_IF:
+		return parser.parseIfStatement()
+	case scanner.TOK_WHILE:
+		return parser.parseWhileStatement()
+	case scanner.TOK_FOR:
+		return parser.parseForStatement()
+	case scanner.TOK_RETURN:
+		return parser.parseReturnStatement()
+	case scanner.TOK_BEGIN:
+		ret := parser.parseCompoundStatement()
+
+		parser.accept(scanner.TOK_SEMI)
+
+		parser.setSpan(ret, next.Pos)
+
+		return ret
+	default:
+	}
+
+	ret := parser.parseSimpleStatement()
+
+	if ret == nil {
+		return nil
+	}
+
+	parser.accept(scanner.TOK_SEMI)
+
+	parser.setSpan(ret, next.Pos)
+
+	return ret
+}
+
+// statement which is not terminated by semicolon itself so that it may be
+// used in for loop header, e.g. i := 0 or i++
+func (parser *Parser) parseSimpleStatement() IStatement {
+	next := parser.scan.Peek()
+	second := parser.scan.PeekSecond()
+
+	if next.TType == scanner.TOK_IDENT &&
+		(second.TType == scanner.TOK_COLON ||
+			second.TType == scanner.TOK_COLON_EQ) {
+		ret := &DefinitionStatement{
+			Def: parser.parseAssignment(),
+		}
+		ret.SetPosition(next.Line, next.Column)
+		parser.setSpan(ret, next.Pos)
+
+		return ret
+	}
+
+	expr := parser.parseExpr()
+
+	if expr == nil {
+		return nil
+	}
+
+	opTok := parser.scan.Peek()
+
+	var ret IStatement
+
+	switch {
+	case opTok.TType == scanner.TOK_PLUS_PLUS ||
+		opTok.TType == scanner.TOK_MINUS_MINUS:
+		parser.scan.Advance()
+
+		parser.checkAssignable(expr)
+
+		ret = &IncDecStatement{
+			Var:   expr,
+			IsInc: opTok.TType == scanner.TOK_PLUS_PLUS,
+		}
+	case isModifyOp(opTok.TType):
+		parser.scan.Advance()
+
+		parser.checkAssignable(expr)
+
+		ret = &ModifyVarStatement{
+			Var:      expr,
+			Operator: opTok,
+			Rhs:      parser.requireExpr(),
+		}
+	default:
+		ret = &ExprStatement{
+			Expr: expr,
+		}
+	}
+
+	ret.SetPosition(next.Line, next.Column)
+	parser.setSpan(ret, next.Pos)
+
+	return ret
+}
+
+func isModifyOp(ttype scanner.TokenType) bool {
+	for _, op := range modifyOps {
+		if ttype == op {
+			return true
+		}
+	}
+
+	return false
+}
+
+// only variables and their members may be modified
+func (parser *Parser) checkAssignable(expr IExpr) {
+	switch expr.(type) {
+	case *IdentExpr, *MemberAccessExpr:
+		return
+	default:
+	}
+
+	var ident IExpr = &IdentExpr{}
+
+	ident.SetPosition(expr.Position())
+	ident.SetSpan(expr.Span())
+
+	parser.expectedNode(ident)
+}
+
+// parse statements until one of the provided token types is next
+// (list begins at start, e.g. begin or first token of body)
+func (parser *Parser) parseStatementList(
+	start *scanner.Token,
+	terminators ...scanner.TokenType,
+) *CompoundStatement {
+	ret := &CompoundStatement{}
+	ret.SetPosition(start.Line, start.Column)
+
+	for !parser.cancelled() {
+		doc := parser.parseDocComment(scanner.TOK_DOC_COMMENT)
+
+		next := parser.scan.Peek()
+
+		if next.TType == scanner.TOK_EOF {
+			break
+		}
+
+		isTerminator := false
+
+		for _, ttype := range terminators {
+			if next.TType == ttype {
+				isTerminator = true
+				break
+			}
+		}
+
+		if isTerminator {
+			break
+		}
+
+		statement := parser.parseStatement()
+
+		if statement == nil {
+			if next.TType == scanner.TOK_FAILURE {
+				parser.malformed(&next)
+			} else {
+				var expected IStatement = &Statement{}
+
+				expected.SetPosition(next.Line, next.Column)
+				expected.SetSpan(next.Pos, next.End())
+
+				parser.expectedNode(expected)
+			}
+
+			// likely missing end, leave definition to caller
+			if isDefinitionToken(next.TType) {
+				break
+			}
+
+			// skip token which cannot begin statement
+			parser.scan.Advance()
+
+			if next.TType == scanner.TOK_SEMI {
+				parser.panicking = false
+			}
+
+			statement = &ErrorStatement{}
+			statement.SetPosition(next.Line, next.Column)
+			statement.SetSpan(next.Pos, next.End())
+		}
+
+		if def, ok := statement.(*DefinitionStatement); ok && def.Def != nil {
+			def.Def.Doc = doc
+		}
+
+		ret.Statements = append(ret.Statements, statement)
+
+		if parser.panicking {
+			parser.synchronize()
+		}
+	}
+
+	parser.setSpan(ret, start.Pos)
+
+	return ret
+}
+
+// e.g. begin x += 1; end
+// (semicolon after end is left for caller)
+func (parser *Parser) parseCompoundStatement() *CompoundStatement {
+	tok, err := parser.accept(scanner.TOK_BEGIN)
+
+	if err != nil {
+		return nil
+	}
+
+	ret := parser.parseStatementList(tok, scanner.TOK_END)
+
+	parser.acceptRelated(scanner.TOK_END, tokenRange(tok))
+
+	parser.setSpan(ret, tok.Pos)
+
+	return ret
+}
+
+// accept "end <keyword>;", e.g. end if;
+// (opener is token which began construct being ended)
+func (parser *Parser) acceptEnd(ttype scanner.TokenType, opener *scanner.Token) {
+	openerRange := tokenRange(opener)
+
+	parser.acceptRelated(scanner.TOK_END, openerRange)
+	parser.acceptRelated(ttype, openerRange)
+	parser.acceptRelated(scanner.TOK_SEMI, openerRange)
+}
+
+// e.g. if x < 5 x += 1; elsif x < 10 x += 2; else x = 0; end if;
+func (parser *Parser) parseIfStatement() IStatement {
+	tok, err := parser.accept(scanner.TOK_IF)
+
+	if err != nil {
+		return nil
+	}
+
+	ret := &IfStatement{}
+	ret.SetPosition(tok.Line, tok.Column)
+
+	for {
+		condition := parser.requireExpr()
+
+		next := parser.scan.Peek()
+
+		body := parser.parseStatementList(
+			&next,
+			scanner.TOK_ELSIF,
+			scanner.TOK_ELSE,
+			scanner.TOK_END,
+		)
+
+		ret.IfThens = append(ret.IfThens, IfThen{
+			Condition: condition,
+			Body:      body,
+		})
+
+		if parser.scan.Peek().TType != scanner.TOK_ELSIF {
+			break
+		}
+
+		parser.scan.Advance()
+	}
+
+	next := parser.scan.Peek()
+
+	if next.TType == scanner.TOK_ELSE {
+		parser.scan.Advance()
+
+		ret.HasElse = true
+
+		second := parser.scan.Peek()
+
+		ret.Else = parser.parseStatementList(&second, scanner.TOK_END)
+	}
+
+	parser.acceptEnd(scanner.TOK_IF, tok)
+
+	parser.setSpan(ret, tok.Pos)
+
+	return ret
+}
+
+// e.g. while i < 10 i++; end while;
+func (parser *Parser) parseWhileStatement() IStatement {
+	tok, err := parser.accept(scanner.TOK_WHILE)
+
+	if err != nil {
+		return nil
+	}
+
+	ret := &LoopStatement{
+		HasCondition: true,
+		Condition:    parser.requireExpr(),
+	}
+	ret.SetPosition(tok.Line, tok.Column)
+
+	next := parser.scan.Peek()
+
+	ret.Body = parser.parseStatementList(&next, scanner.TOK_END)
+
+	parser.acceptEnd(scanner.TOK_WHILE, tok)
+
+	parser.setSpan(ret, tok.Pos)
+
+	return ret
+}
+
+// e.g. for i := 0; i < 10; i++; x += i; end for;
+// (any of the three header components may be omitted, each ends with ';'
+// so that body is not taken as step, e.g. for ;;; x += 1; end for;)
+func (parser *Parser) parseForStatement() IStatement {
+	tok, err := parser.accept(scanner.TOK_FOR)
+
+	if err != nil {
+		return nil
+	}
+
+	ret := &LoopStatement{}
+	ret.SetPosition(tok.Line, tok.Column)
+
+	if parser.scan.Peek().TType != scanner.TOK_SEMI {
+		ret.Before = parser.parseSimpleStatement()
+		ret.HasBefore = (ret.Before != nil)
+	}
+
+	parser.accept(scanner.TOK_SEMI)
+
+	if parser.scan.Peek().TType != scanner.TOK_SEMI {
+		ret.Condition = parser.parseExpr()
+		ret.HasCondition = (ret.Condition != nil)
+	}
+
+	parser.accept(scanner.TOK_SEMI)
+
+	if parser.scan.Peek().TType != scanner.TOK_SEMI {
+		ret.After = parser.parseSimpleStatement()
+		ret.HasAfter = (ret.After != nil)
+	}
+
+	parser.accept(scanner.TOK_SEMI)
+
+	next := parser.scan.Peek()
+
+	ret.Body = parser.parseStatementList(&next, scanner.TOK_END)
+
+	parser.acceptEnd(scanner.TOK_FOR, tok)
+
+	parser.setSpan(ret, tok.Pos)
+
+	return ret
+}
+
+// e.g. return x;
+func (parser *Parser) parseReturnStatement() IStatement {
+	tok, err := parser.accept(scanner.TOK_RETURN)
+
+	if err != nil {
+		return nil
+	}
+
+	ret := &ReturnStatement{}
+	ret.SetPosition(tok.Line, tok.Column)
+
+	if parser.scan.Peek().TType != scanner.TOK_SEMI {
+		ret.HasValue = true
+		ret.Value = parser.requireExpr()
+	}
+
+	parser.accept(scanner.TOK_SEMI)
+
+	parser.setSpan(ret, tok.Pos)
+
+	return ret
 }
@@ -1,6 +1,8 @@
 package parser
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"pegasus/scanner"
 )
@@ -10,10 +12,8 @@ const MAX_PARSE_ERRORS = 100
 
 func (parser *Parser) initParser() {
 	nodeChan := make(chan INode, MAX_BUFFERED_NODES)
-	errChan := make(chan ParseError, MAX_PARSE_ERRORS)
 
 	parser.nodeChan = &nodeChan
-	parser.errChan = &errChan
 }
 
 func (parser *Parser) ErrorCount() int {
@@ -23,42 +23,135 @@ func (parser *Parser) ErrorCount() int {
 func NewParser(scan *scanner.Scanner) *Parser {
 	var parser Parser
 
-	parser.initParser()
-
-	parser.scan = scan
+	parser.SetScanner(scan)
+	parser.ctx = context.Background()
 
 	return &parser
 }
 
 func (parser *Parser) SetScanner(scan *scanner.Scanner) {
 	parser.scan = scan
+
+	// doc comments are only taken where a definition or member may begin,
+	// elsewhere (e.g. in an argument list) they are ignored
+	if scan != nil {
+		scan.SetSkipDocComments(true)
+	}
 }
 
 func (parser *Parser) send(node INode) {
-	if node != nil {
-		*parser.nodeChan <- node
+	if node == nil {
+		return
+	}
+
+	select {
+	case *parser.nodeChan <- node:
+	case <-parser.ctx.Done():
 	}
 }
 
+// Channel on which nodes (currently just *File) are sent by most recent
+// Parse, closed once parsing ends. nil before Parse is called.
+func (parser *Parser) Nodes() <-chan INode {
+	if parser.nodeChan == nil {
+		return nil
+	}
+
+	return *parser.nodeChan
+}
+
+// true => parsing should stop early
+func (parser *Parser) cancelled() bool {
+	return parser.ctx.Err() != nil
+}
+
+// e.g. scanner stopped by cancelled context, rather than failure to read
+func isCancellation(err error) bool {
+	return errors.Is(err, context.Canceled) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// tokens which begin top-level definitions
+var definitionTokens []scanner.TokenType = []scanner.TokenType{
+	scanner.TOK_FUNCTION,
+	scanner.TOK_STRUCT,
+	scanner.TOK_CLASS,
+	scanner.TOK_ENUM,
+	scanner.TOK_VARIANT,
+}
+
+func isDefinitionToken(ttype scanner.TokenType) bool {
+	for _, defTType := range definitionTokens {
+		if ttype == defTType {
+			return true
+		}
+	}
+
+	return false
+}
+
 func (parser *Parser) addError(err *ParseError) {
-	if parser.errCount.Load() < MAX_PARSE_ERRORS {
-		parser.errCount.Add(1)
+	// error is likely consequence of previous one
+	if parser.panicking {
+		return
+	}
+
+	parser.panicking = true
+
+	parser.report(SEVERITY_ERROR, err)
+}
 
-		*parser.errChan <- *err
+// add diagnostic without entering panic mode,
+// for problems which are not syntax errors
+func (parser *Parser) report(severity Severity, err *ParseError) {
+	// input was cut short, so error is likely just from its missing end
+	// (cancellation is reported instead once parsing stops), scanner may
+	// have been cancelled by its own context
+	if parser.cancelled() || isCancellation(parser.scan.Err()) {
+		return
 	}
+
+	line, _ := err.Position()
+
+	err.Severity = severity
+	err.Filename = parser.scan.Filename()
+	err.SourceLine = parser.scan.SourceLine(line)
+
+	parser.addDiagnostic(severity, err)
 }
 
 func (parser *Parser) accept(ttype scanner.TokenType) (*scanner.Token, error) {
+	return parser.acceptRelated(ttype)
+}
+
+// accept, with related source ranges added to error if token is not found
+func (parser *Parser) acceptRelated(
+	ttype scanner.TokenType,
+	related ...SourceRange,
+) (*scanner.Token, error) {
 	t := parser.scan.Peek()
 
 	if t.TType == ttype {
 		parser.scan.Advance()
+
+		// end of statement or definition, can report errors again
+		if ttype == scanner.TOK_SEMI {
+			parser.panicking = false
+		}
+
 		return &t, nil
 	}
 
+	// e.g. unterminated string where ";" was expected
+	if t.TType == scanner.TOK_FAILURE {
+		return nil, parser.malformed(&t)
+	}
+
 	e := ParseError{
+		Code:     DIAG_UNEXPECTED_TOKEN,
 		Expected: ttype,
 		Found:    t,
+		Related:  related,
 	}
 
 	parser.addError(&e)
@@ -66,125 +159,221 @@ func (parser *Parser) accept(ttype scanner.TokenType) (*scanner.Token, error) {
 	return nil, &e
 }
 
+// span node from start to end of last token consumed
+// (empty if none has been consumed since)
+func (parser *Parser) setSpan(node spanner, start scanner.Pos) {
+	node.SetSpan(start, max(start, parser.scan.LastEnd()))
+}
+
 func (parser *Parser) expectedNode(node INode) {
 	e := ParseError{
+		Code:         DIAG_EXPECTED_NODE,
 		ExpectedNode: node,
-		Message: fmt.Sprintf(
-			"Expected but did not find node of type %T",
-			node,
-		),
+		Message:      "expected " + nodeDesc(node),
 	}
 
 	parser.addError(&e)
 }
 
-func (parser *Parser) malformed(tok *scanner.Token) {
+func (parser *Parser) malformed(tok *scanner.Token) *ParseError {
+	message := fmt.Sprintf("malformed %s %q", tok.TType.Desc(), tok.Text)
+
+	if tok.TType == scanner.TOK_FAILURE {
+		message = fmt.Sprintf("invalid token %q", tok.Text)
+
+		if tok.Reason != "" {
+			message = tok.Reason
+		}
+	}
+
 	e := &ParseError{
+		Code:     DIAG_MALFORMED_TOKEN,
 		Expected: tok.TType,
 		Found:    *tok,
-		Message:  "malformed token",
+		Message:  message,
 	}
 
-	parser.addError(e)
-}
-
-func (parser *Parser) parse() {
-	parser.send(parser.parseFile())
+	if tok.TType == scanner.TOK_FAILURE {
+		// lexical errors are independent of each other, so all are
+		// reported even in panic mode (each once)
+		if tok.Pos != parser.lastFailure || !tok.Pos.IsValid() {
+			parser.report(SEVERITY_ERROR, e)
+		}
 
-}
+		parser.lastFailure = tok.Pos
+		parser.panicking = true
 
-func (parser *Parser) Parse() {
-	if parser.scan == nil {
-		return
-	}
-	if parser.nodeChan == nil {
-		parser.initParser()
+		return e
 	}
 
-	go parser.parse()
-}
+	parser.addError(e)
 
-func (parser *Parser) parseFile() *File {
-	var f File
+	return e
+}
 
+// skip tokens until after ";" or before "end", "elsif", "else" or a
+// definition keyword so that parsing may resume after error
+// (invalid tokens skipped are still reported)
+//
+// stopping before "end", "elsif" or "else" does not end panic mode, since
+// enclosing construct must still accept them
+func (parser *Parser) synchronize() {
 	for {
-		def := parser.parseDefinition()
-
-		if def == nil {
-			break
+		tok := parser.scan.Peek()
+
+		switch tok.TType {
+		case scanner.TOK_END,
+			scanner.TOK_ELSIF,
+			scanner.TOK_ELSE:
+			return
+		case scanner.TOK_EOF:
+			parser.panicking = false
+			return
+		case scanner.TOK_SEMI:
+			parser.scan.Advance()
+			parser.panicking = false
+			return
+		default:
 		}
 
-		f.definitions = append(f.definitions, def)
-	}
+		if isDefinitionToken(tok.TType) {
+			parser.panicking = false
+			return
+		}
 
-	f.SetPosition(1, 1)
+		if tok.TType == scanner.TOK_FAILURE {
+			parser.malformed(&tok)
+		}
 
-	return &f
+		parser.scan.Advance()
+	}
 }
 
-func (parser *Parser) parseDefinition() *Definition {
+// report unexpected token in member list (e.g. of struct) and skip past
+// it, returns false if list should be ended instead
+func (parser *Parser) recoverMember() bool {
 	next := parser.scan.Peek()
 
-	switch next.TType {
-	case scanner.TOK_STRUCT, scanner.TOK_CLASS:
-		return parser.parseTypeDef()
-	case scanner.TOK_ENUM:
-		return parser.parseEnumDef()
-	case scanner.TOK_FUNCTION:
-		return parser.parseFunctionDef()
-	case scanner.TOK_IDENT:
-		return parser.parseAssignment()
-	default:
+	// only members or end of list may be found
+	if next.TType == scanner.TOK_FAILURE {
+		parser.malformed(&next)
+	} else {
+		parser.accept(scanner.TOK_END)
+	}
+
+	if isDefinitionToken(next.TType) {
+		return false
+	}
+
+	parser.scan.Advance()
+
+	if next.TType == scanner.TOK_SEMI {
+		parser.panicking = false
+	} else {
+		parser.synchronize()
 	}
 
-	return nil
+	return true
 }
 
-func (parser *Parser) parseTypeDef() *Definition {
-	return nil
+func (parser *Parser) parse(nodeChan chan INode) {
+	defer close(nodeChan)
+
+	parser.send(parser.parseFile())
 }
 
-func (parser *Parser) parseEnumDef() *Definition {
-	next := parser.scan.Peek()
+func (parser *Parser) Parse() {
+	parser.ParseContext(context.Background())
+}
 
-	if next.TType != scanner.TOK_ENUM {
-		return nil
+// Parse, with parsing stopped once ctx is cancelled
+// (ctx.Err() is then reported in Diagnostics)
+func (parser *Parser) ParseContext(ctx context.Context) {
+	if parser.scan == nil {
+		return
 	}
 
-	return nil
-}
+	parser.ctx = ctx
+
+	parser.initParser()
 
-func (parser *Parser) parseFunctionDef() *Definition {
-	return nil
+	go parser.parse(*parser.nodeChan)
 }
 
-func (parser *Parser) parseAssignment() *Definition {
-	next := parser.scan.Peek()
+func (parser *Parser) parseFile() *File {
+	var f File
 
-	if next.TType != scanner.TOK_IDENT {
-		return nil
-	}
+	for !parser.cancelled() {
+		if parser.scan.PeekDocComment().TType == scanner.TOK_FILE_DOC_COMMENT {
+			doc := parser.parseDocComment(scanner.TOK_FILE_DOC_COMMENT)
 
-	parser.scan.Advance()
+			if f.Doc != "" {
+				f.Doc += "\n"
+			}
 
-	var ret Definition
-	ret.SetPosition(next.Line, next.Column)
+			f.Doc += doc
 
-	next = parser.scan.Peek()
+			continue
+		}
 
-	if next.TType == scanner.TOK_COLON {
-		ret.Type = parser.parseExpr()
+		next := parser.scan.Peek()
 
-		parser.accept(scanner.TOK_EQ)
-	} else {
-		ret.InferType = true
+		if next.TType == scanner.TOK_EOF {
+			break
+		}
+
+		def := parser.parseDefinition()
+
+		if def != nil {
+			f.definitions = append(f.definitions, def)
+
+			if parser.panicking {
+				parser.synchronize()
+			}
 
-		parser.accept(scanner.TOK_COLON_EQ)
+			continue
+		}
+
+		// could not parse definition
+
+		if next.TType == scanner.TOK_FAILURE {
+			parser.malformed(&next)
+		} else {
+			var expected IDefinition = &Definition{}
+
+			expected.SetPosition(next.Line, next.Column)
+			expected.SetSpan(next.Pos, next.End())
+
+			parser.expectedNode(expected)
+		}
+
+		switch next.TType {
+		case scanner.TOK_END, scanner.TOK_ELSIF, scanner.TOK_ELSE:
+			// synchronize would stop here
+			parser.scan.Advance()
+		default:
+		}
+
+		parser.synchronize()
+	}
+
+	if err := parser.ctx.Err(); err != nil {
+		parser.addCancelled(err)
+	} else if err := parser.scan.Err(); err != nil {
+		if isCancellation(err) {
+			parser.addCancelled(err)
+		} else {
+			parser.addInputError(err)
+		}
 	}
 
-	ret.Value = parser.parseExpr()
+	f.SetPosition(1, 1)
+
+	if file := parser.scan.File(); file != nil {
+		f.SetSpan(file.Pos(0), file.Pos(file.Size()))
+	}
 
-	return &ret
+	return &f
 }
 
 func (parser *Parser) parseCallArgs() CallArgs {
@@ -214,21 +403,9 @@ func (parser *Parser) parseCallArgs() CallArgs {
 			arg.Name = tok1.Text
 		}
 
-		arg.Value = parser.parseExpr()
-
-		if arg.Value == nil {
-			var expr IExpr = &Expr{}
-
-			tok := parser.scan.Peek()
-
-			expr.SetPosition(tok.Line, tok.Column)
+		arg.Value = parser.requireExpr()
 
-			// failed to find expression when one was expected
-
-			parser.expectedNode(expr)
-
-			arg.Value = expr
-		}
+		parser.setSpan(&arg, tok1.Pos)
 
 		args.ArgList = append(args.ArgList, arg)
 
@@ -241,5 +418,7 @@ func (parser *Parser) parseCallArgs() CallArgs {
 		parser.scan.Advance()
 	}
 
+	parser.setSpan(&args, tok.Pos)
+
 	return args
 }
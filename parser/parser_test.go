@@ -1,8 +1,13 @@
 package parser
 
 import (
+	"context"
 	"errors"
+	"io/fs"
+	"math/big"
+	"path/filepath"
 	"pegasus/scanner"
+	"strings"
 	"testing"
 )
 
@@ -27,7 +32,7 @@ func createUnary(ttype scanner.TokenType, subexpr IExpr) IExpr {
 
 func TestPrintExpr(t *testing.T) {
 	exprs := [...]IExpr{
-		createBinary(scanner.TOK_PLUS, &IntegerLiteral{Value: 5}, &IntegerLiteral{Value: 5}),
+		createBinary(scanner.TOK_PLUS, &IntegerLiteral{Value: big.NewInt(5)}, &IntegerLiteral{Value: big.NewInt(5)}),
 		createUnary(scanner.TOK_PLUS, &FloatLiteral{Value: 10}),
 	}
 	strs := [...]string{
@@ -79,6 +84,9 @@ func TestParseValidExprs(t *testing.T) {
 		"(1 + 2) * 3",
 		"x + 2",
 		"+++5",
+		"0xFF + 0b1010 + 0o17",
+		"1_000_000",
+		"99999999999999999999 + 0xFFFFFFFFFFFFFFFFFF",
 	}
 	outputs := [...]string{
 		"(+ 5 5)",
@@ -91,6 +99,9 @@ func TestParseValidExprs(t *testing.T) {
 		"(* (+ 1 2) 3)",
 		"(+ x 2)",
 		"(+ (+ (+ 5)))",
+		"(+ (+ 255 10) 15)",
+		"1000000",
+		"(+ 99999999999999999999 4722366482869645213695)",
 	}
 
 	nLoops := min(len(exprs), len(outputs))
@@ -124,6 +135,11 @@ func TestParseValidPostfixExprs(t *testing.T) {
 		"f(1)(2).g(3)",
 		"List[Integer]",
 		"f(1, 2, 3) + 3",
+		"lambda (a, b) => a < b",
+		"lambda (x : Integer) : Integer => x * 2",
+		"lambda () begin log(1); end",
+		"sort(xs, key=lambda (a : Point) => a.x)",
+		"on(lambda (e) begin handle(e); end, 5)",
 	}
 	outputs := [...]string{
 		"(f 1 2 3)",
@@ -133,6 +149,11 @@ func TestParseValidPostfixExprs(t *testing.T) {
 		"(((f 1) 2).g 3)",
 		"(List Integer)",
 		"(+ (f 1 2 3) 3)",
+		"(lambda (a b) _ (< a b))",
+		"(lambda ((: x Integer)) Integer (* x 2))",
+		"(lambda () _ (begin (log 1)))",
+		"(sort xs key=(lambda ((: a Point)) _ a.x))",
+		"(on (lambda (e) _ (begin (handle e))) 5)",
 	}
 
 	nLoops := min(len(exprs), len(outputs))
@@ -156,3 +177,1282 @@ func TestParseValidPostfixExprs(t *testing.T) {
 		}
 	}
 }
+
+func parseStatementForTest(s string) (string, error) {
+	scan := scanner.NewScanner()
+
+	scan.Tokenize(s)
+
+	parse := NewParser(scan)
+
+	statement := parse.parseStatement()
+
+	if parse.ErrorCount() > 0 {
+		return "", errors.New("non-zero error count")
+	}
+
+	return StatementToString(statement), nil
+}
+
+func TestParseValidStatements(t *testing.T) {
+	statements := [...]string{
+		"x += 10;",
+		"i++;",
+		"point.x = 5;",
+		"f(1, 2);",
+		"x := 0;",
+		"x : Integer = 0;",
+		"begin x = 1; y--; end;",
+		"begin end;",
+		"if x < 5 x = x + 1; end if;",
+		"if x < 5 x = 1; elsif x < 10 x = 2; else x = 3; end if;",
+		"while i < 10 i++; end while;",
+		"for i := 0; i < 10; i++; x += i; end for;",
+		"for ; i < 10; i++; f(); end for;",
+		"for ;;; x += 1; end for;",
+		"for i := 0;;; end for;",
+	}
+	outputs := [...]string{
+		"(+= x 10)",
+		"(++ i)",
+		"(= point.x 5)",
+		"(f 1 2)",
+		"(:= x 0)",
+		"(: x Integer 0)",
+		"(begin (= x 1) (-- y))",
+		"(begin)",
+		"(if ((< x 5) (begin (= x (+ x 1)))))",
+		"(if ((< x 5) (begin (= x 1))) ((< x 10) (begin (= x 2))) (else (begin (= x 3))))",
+		"(loop _ (< i 10) _ (begin (++ i)))",
+		"(loop (:= i 0) (< i 10) (++ i) (begin (+= x i)))",
+		"(loop _ (< i 10) (++ i) (begin (f)))",
+		"(loop _ _ _ (begin (+= x 1)))",
+		"(loop (:= i 0) _ _ (begin))",
+	}
+
+	nLoops := min(len(statements), len(outputs))
+
+	for i := 0; i < nLoops; i++ {
+		got, err := parseStatementForTest(statements[i])
+
+		if err != nil {
+			t.Errorf("Unexpected err while parsing \"%s\"", statements[i])
+			continue
+		}
+
+		expected := outputs[i]
+
+		if got != expected {
+			t.Errorf(
+				"Expected \"%s\", got \"%s\"",
+				expected,
+				got,
+			)
+		}
+	}
+}
+
+func TestParseInvalidStatements(t *testing.T) {
+	statements := [...]string{
+		"x += 10",
+		"x + 1 = 5;",
+		"if x < 5 x = 1; end while;",
+		"while x < 5 x = 1;",
+		"begin x = 1;",
+	}
+
+	for _, s := range statements {
+		_, err := parseStatementForTest(s)
+
+		if err == nil {
+			t.Errorf("Expected error while parsing \"%s\"", s)
+		}
+	}
+}
+
+func parseFileForTest(s string) ([]string, error) {
+	scan := scanner.NewScanner()
+
+	scan.Tokenize(s)
+
+	parse := NewParser(scan)
+
+	f := parse.parseFile()
+
+	if parse.ErrorCount() > 0 {
+		return nil, errors.New("non-zero error count")
+	}
+
+	defStrs := make([]string, len(f.definitions))
+
+	for i, def := range f.definitions {
+		defStrs[i] = DefinitionToString(def)
+	}
+
+	return defStrs, nil
+}
+
+func checkParsedFiles(t *testing.T, files []string, outputs [][]string) {
+	nLoops := min(len(files), len(outputs))
+
+	for i := 0; i < nLoops; i++ {
+		got, err := parseFileForTest(files[i])
+
+		if err != nil {
+			t.Errorf("Unexpected err while parsing \"%s\"", files[i])
+			continue
+		}
+
+		expected := outputs[i]
+
+		if len(got) != len(expected) {
+			t.Errorf("Expected %d definitions, got %d", len(expected), len(got))
+			continue
+		}
+
+		for j := range expected {
+			if got[j] != expected[j] {
+				t.Errorf(
+					"Expected \"%s\", got \"%s\"",
+					expected[j],
+					got[j],
+				)
+			}
+		}
+	}
+}
+
+func TestParseFunctionDefs(t *testing.T) {
+	files := [...]string{
+		"function f() begin end;",
+		"function inc(x : Integer) : Integer begin return x + 1; end;",
+		`function add(a : Integer, b : Integer = 0, c := 1) : Integer
+		begin
+			total := a + b;
+			total += c;
+			return total;
+		end;
+
+		x := add(1, c=2);`,
+		"function g() : List[Integer] return list(); function h() begin return; end;",
+	}
+	outputs := [...][]string{
+		{"(function f () _ (begin))"},
+		{"(function inc ((: x Integer)) Integer (begin (return (+ x 1))))"},
+		{
+			"(function add ((: a Integer) (: b Integer 0) (:= c 1)) Integer " +
+				"(begin (:= total (+ a b)) (+= total c) (return total)))",
+			"(:= x (add 1 c=2))",
+		},
+		{
+			"(function g () (List Integer) (return (list)))",
+			"(function h () _ (begin (return)))",
+		},
+	}
+
+	checkParsedFiles(t, files[:], outputs[:])
+}
+
+func TestParseInvalidFunctionDefs(t *testing.T) {
+	files := [...]string{
+		"function () begin end;",
+		"function f(x) begin end;",
+		"function f(x : Integer begin end;",
+		"function f()",
+		"function f() begin end; 5",
+	}
+
+	for _, s := range files {
+		_, err := parseFileForTest(s)
+
+		if err == nil {
+			t.Errorf("Expected error while parsing \"%s\"", s)
+		}
+	}
+}
+
+func TestParseTypeDefs(t *testing.T) {
+	files := [...]string{
+		"struct Empty end struct;",
+		"struct Point x : Integer = 0; y : Integer; end struct;",
+		"struct Pair[K, V] key : K; value : V; end struct;",
+		`class Stack[T, N : Integer]
+			items : Array[T, N];
+			size := 0;
+
+			function push(item : T)
+			begin
+				items.set(size, item);
+				size++;
+			end;
+		end class;`,
+	}
+	outputs := [...][]string{
+		{"(struct Empty () ())"},
+		{"(struct Point () ((: x Integer 0) (: y Integer)))"},
+		{"(struct Pair (K V) ((: key K) (: value V)))"},
+		{
+			"(class Stack (T (: N Integer)) ((: items (Array T N)) (:= size 0)) " +
+				"((function push ((: item T)) _ " +
+				"(begin (items.set size item) (++ size)))))",
+		},
+	}
+
+	checkParsedFiles(t, files[:], outputs[:])
+}
+
+func TestParseInvalidTypeDefs(t *testing.T) {
+	files := [...]string{
+		"struct end struct;",
+		"struct Point x : Integer = 0; end class;",
+		"struct Point function f() begin end; end struct;",
+		"struct Point x : Integer end struct;",
+		"class List[T end class;",
+	}
+
+	for _, s := range files {
+		_, err := parseFileForTest(s)
+
+		if err == nil {
+			t.Errorf("Expected error while parsing \"%s\"", s)
+		}
+	}
+}
+
+func TestParseEnumAndVariantDefs(t *testing.T) {
+	files := [...]string{
+		"enum Empty end enum;",
+		"enum Color Red; Green = 5; Blue; end enum;",
+		"enum Flags Read = 1 << 0; Write = 1 << 1; end enum;",
+		`variant Result[T]
+			Ok(value : T);
+			Err(message : String, code : Integer = 0);
+			Cancelled;
+		end variant;`,
+	}
+	outputs := [...][]string{
+		{"(enum Empty ())"},
+		{"(enum Color (Red (Green 5) Blue))"},
+		{"(enum Flags ((Read (<< 1 0)) (Write (<< 1 1))))"},
+		{
+			"(variant Result (T) ((Ok (: value T)) " +
+				"(Err (: message String) (: code Integer 0)) Cancelled))",
+		},
+	}
+
+	checkParsedFiles(t, files[:], outputs[:])
+}
+
+func TestParseInvalidEnumAndVariantDefs(t *testing.T) {
+	files := [...]string{
+		"enum Color Red Green; end enum;",
+		"enum Color Red = ; end enum;",
+		"enum Color Red; end variant;",
+		"variant Option[T] Some(value); None; end variant;",
+		"variant Option[T] Some(value : T; end variant;",
+	}
+
+	for _, s := range files {
+		_, err := parseFileForTest(s)
+
+		if err == nil {
+			t.Errorf("Expected error while parsing \"%s\"", s)
+		}
+	}
+}
+
+func TestParseInvalidLambdas(t *testing.T) {
+	exprs := [...]string{
+		"lambda a => a",
+		"lambda (a) a",
+		"lambda (a) =>",
+		"lambda (a) begin a++;",
+	}
+
+	for _, s := range exprs {
+		_, err := parseExprForTest(s)
+
+		if err == nil {
+			t.Errorf("Expected error while parsing \"%s\"", s)
+		}
+	}
+}
+
+func TestParseErrorRecovery(t *testing.T) {
+	files := [...]string{
+		"x := ;\ny := 5;\nz := );\n",
+		`function f()
+		begin
+			x = ;
+			y = 1;
+			z = = 2;
+			) ;
+		end;
+
+		function g() begin return 1 end;
+
+		struct Point x : ; y : Integer; 5; end struct;
+
+		enum Color Red = ; Green; end enum;`,
+		"if x end if; 5; end; x := 1;",
+		"function f() begin x = 1; function g() begin end;",
+		"function f() begin while x < 5 x = ) ; else end while; end;",
+	}
+	outputs := [...][]string{
+		{"(:= x ERR)", "(:= y 5)", "(:= z ERR)"},
+		{
+			"(function f () _ (begin (= x ERR) (= y 1) (= z ERR) ERR))",
+			"(function g () _ (begin (return 1)))",
+			"(struct Point () ((: x ERR) (: y Integer)))",
+			"(enum Color ((Red ERR) Green))",
+		},
+		{"(:= x 1)"},
+		{
+			"(function f () _ (begin (= x 1)))",
+			"(function g () _ (begin))",
+		},
+		{"(function f () _ (begin (loop _ (< x 5) _ (begin (= x ERR) ERR))))"},
+	}
+	errCounts := [...]int{2, 7, 3, 1, 2}
+
+	nLoops := min(len(files), len(outputs), len(errCounts))
+
+	for i := 0; i < nLoops; i++ {
+		scan := scanner.NewScanner()
+
+		scan.Tokenize(files[i])
+
+		parse := NewParser(scan)
+
+		f := parse.parseFile()
+
+		if parse.ErrorCount() != errCounts[i] {
+			t.Errorf(
+				"Expected %d errors in \"%s\", got %d",
+				errCounts[i],
+				files[i],
+				parse.ErrorCount(),
+			)
+		}
+
+		got := make([]string, 0, len(f.definitions))
+
+		for _, def := range f.definitions {
+			got = append(got, DefinitionToString(def))
+		}
+
+		if len(got) != len(outputs[i]) {
+			t.Errorf("Expected %v, got %v", outputs[i], got)
+			continue
+		}
+
+		for j := range got {
+			if got[j] != outputs[i][j] {
+				t.Errorf(
+					"Expected \"%s\", got \"%s\"",
+					outputs[i][j],
+					got[j],
+				)
+			}
+		}
+	}
+}
+
+func TestParseErrorFormat(t *testing.T) {
+	files := [...]string{
+		"x y;",
+		"\tx\tyy;",
+		"function f() begin\n\tx = 5\nend;",
+	}
+	outputs := [...]string{
+		"1:3: error: expected Assign + Infer Type (':='), found \"y\"\n" +
+			"x y;\n" +
+			"  ^",
+		"1:4: error: expected Assign + Infer Type (':='), found \"yy\"\n" +
+			"\tx\tyy;\n" +
+			"\t \t^^",
+		"3:1: error: expected Semicolon (';'), found \"end\"\n" +
+			"end;\n" +
+			"^^^",
+	}
+
+	nLoops := min(len(files), len(outputs))
+
+	for i := 0; i < nLoops; i++ {
+		scan := scanner.NewScanner()
+
+		scan.Tokenize(files[i])
+
+		parse := NewParser(scan)
+
+		parse.parseFile()
+
+		if parse.ErrorCount() != 1 {
+			t.Errorf("Expected 1 error, got %d", parse.ErrorCount())
+			continue
+		}
+
+		diags := parse.Diagnostics()
+
+		if got := diags[0].Error(); got != outputs[i] {
+			t.Errorf("Expected \"%s\", got \"%s\"", outputs[i], got)
+		}
+	}
+
+	err := ParseError{
+		Expected:   scanner.TOK_SEMI,
+		Found:      scanner.Token{TType: scanner.TOK_IDENT, Line: 2, Column: 5, Width: 1, Text: "y"},
+		Filename:   "main.pgs",
+		SourceLine: "x = y",
+	}
+
+	expected := "main.pgs:2:5: error: expected Semicolon (';'), found \"y\"\nx = y\n    ^"
+
+	if got := err.Error(); got != expected {
+		t.Errorf("Expected \"%s\", got \"%s\"", expected, got)
+	}
+
+	if got := err.Format(true); got == expected || !strings.Contains(got, "\x1b[") {
+		t.Errorf("Expected ANSI colour in \"%s\"", got)
+	}
+
+	// label follows severity of diagnostic
+	scan := scanner.NewScanner()
+
+	scan.Tokenize("x = y")
+
+	parse := NewParser(scan)
+
+	warning := err
+
+	parse.report(SEVERITY_WARNING, &warning)
+
+	expected = "2:5: warning: expected Semicolon (';'), found \"y\""
+
+	diags := parse.Diagnostics()
+
+	if len(diags) != 1 || diags[0].Severity != SEVERITY_WARNING || diags[0].Error() != expected {
+		t.Fatalf("Expected warning \"%s\", got %v", expected, diags)
+	}
+
+	if got := warning.Format(true); !strings.Contains(got, ansiYellow+"warning:") {
+		t.Errorf("Expected yellow warning label in \"%s\"", got)
+	}
+}
+
+func TestDiagnostics(t *testing.T) {
+	scan := scanner.NewScanner()
+
+	scan.Tokenize("function f() begin\n\tif x\n\t\ty = 1;\n\tend while;\nend;\nz := ;\n")
+
+	parse := NewParser(scan)
+
+	parse.parseFile()
+
+	diags := parse.Diagnostics()
+
+	if len(diags) != 2 {
+		t.Fatalf("Expected 2 diagnostics, got %d", len(diags))
+	}
+
+	endDiag := diags[0]
+
+	if endDiag.Severity != SEVERITY_ERROR || endDiag.Code != DIAG_UNEXPECTED_TOKEN {
+		t.Errorf("Unexpected severity %s or code %s", endDiag.Severity, endDiag.Code)
+	}
+
+	// "while" in "end while;"
+	primary := endDiag.Primary
+
+	if primary.Line != 4 || primary.EndColumn-primary.Column != 5 {
+		t.Errorf("Unexpected primary range %v", primary)
+	}
+
+	expectedSecondary := SourceRange{Line: 2, Column: 2, EndColumn: 4}
+
+	if len(endDiag.Secondary) != 1 || endDiag.Secondary[0] != expectedSecondary {
+		t.Errorf("Expected secondary range %v, got %v", expectedSecondary, endDiag.Secondary)
+	}
+
+	var parseErr *ParseError
+
+	if !errors.As(endDiag.Err, &parseErr) || parseErr.Expected != scanner.TOK_IF {
+		t.Errorf("Expected *ParseError expecting If, got %v", endDiag.Err)
+	}
+
+	if diags[1].Code != DIAG_EXPECTED_NODE || diags[1].Primary.Line != 6 {
+		t.Errorf("Unexpected second diagnostic %v", diags[1])
+	}
+}
+
+func TestTooManyErrors(t *testing.T) {
+	src := strings.Repeat("x := ;\n", MAX_PARSE_ERRORS+10)
+
+	scan := scanner.NewScanner()
+
+	scan.Tokenize(src)
+
+	parse := NewParser(scan)
+
+	parse.parseFile()
+
+	diags := parse.Diagnostics()
+
+	if parse.ErrorCount() != MAX_PARSE_ERRORS {
+		t.Errorf("Expected %d errors, got %d", MAX_PARSE_ERRORS, parse.ErrorCount())
+	}
+
+	if len(diags) != MAX_PARSE_ERRORS+1 {
+		t.Fatalf("Expected %d diagnostics, got %d", MAX_PARSE_ERRORS+1, len(diags))
+	}
+
+	last := diags[len(diags)-1]
+
+	if last.Code != DIAG_TOO_MANY_ERRORS || !errors.Is(last.Err, ErrTooManyErrors) {
+		t.Errorf("Expected too many errors sentinel, got %v", last)
+	}
+}
+
+func TestParseNodes(t *testing.T) {
+	scan := scanner.NewPipelineScanner()
+
+	scan.Tokenize("x := 5; function f() begin end;")
+
+	parse := NewParser(scan)
+
+	parse.Parse()
+
+	nodes := 0
+
+	for node := range parse.Nodes() {
+		f, ok := node.(*File)
+
+		if !ok || len(f.definitions) != 2 {
+			t.Errorf("Expected file with 2 definitions, got %v", node)
+		}
+
+		nodes++
+	}
+
+	if nodes != 1 || parse.ErrorCount() != 0 {
+		t.Errorf("Expected 1 node and no errors, got %d and %d", nodes, parse.ErrorCount())
+	}
+}
+
+func TestParseCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	cancel()
+
+	scan := scanner.NewPipelineScanner()
+
+	scan.TokenizeContext(ctx, strings.Repeat("x := 5;\n", 1000))
+
+	parse := NewParser(scan)
+
+	parse.ParseContext(ctx)
+
+	// channel is closed once parse goroutine ends
+	for range parse.Nodes() {
+	}
+
+	diags := parse.Diagnostics()
+
+	if len(diags) != 1 {
+		t.Fatalf("Expected 1 diagnostic, got %d", len(diags))
+	}
+
+	if diags[0].Code != DIAG_CANCELLED || !errors.Is(diags[0].Err, context.Canceled) {
+		t.Errorf("Expected cancellation diagnostic, got %v", diags[0])
+	}
+}
+
+// returns chunk on first read, then cancels and blocks until ctx is done
+type cancellingReader struct {
+	chunk  string
+	ctx    context.Context
+	cancel context.CancelFunc
+	read   bool
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	if !r.read {
+		r.read = true
+
+		return copy(p, r.chunk), nil
+	}
+
+	r.cancel()
+
+	<-r.ctx.Done()
+
+	return 0, r.ctx.Err()
+}
+
+func TestParseCancelledMidStream(t *testing.T) {
+	newScanners := []func() *scanner.Scanner{
+		scanner.NewScanner,
+		scanner.NewPipelineScanner,
+	}
+
+	for _, newScanner := range newScanners {
+		// parser shares scanner's context or only scanner is cancelled
+		for _, shared := range [...]bool{true, false} {
+			ctx, cancel := context.WithCancel(context.Background())
+
+			// cut off inside function body
+			r := &cancellingReader{
+				chunk:  "x := 1;\nfunction f() begin\n\ty := (2 +",
+				ctx:    ctx,
+				cancel: cancel,
+			}
+
+			scan := newScanner()
+
+			scan.TokenizeReaderContext(ctx, r)
+
+			parse := NewParser(scan)
+
+			if shared {
+				parse.ParseContext(ctx)
+			} else {
+				parse.Parse()
+			}
+
+			for range parse.Nodes() {
+			}
+
+			diags := parse.Diagnostics()
+
+			if len(diags) != 1 || diags[0].Code != DIAG_CANCELLED {
+				t.Errorf("Expected only cancellation diagnostic, got %v", diags)
+			}
+
+			cancel()
+		}
+	}
+}
+
+func TestParseMalformedIntegers(t *testing.T) {
+	exprs := [...]string{
+		"0x",
+		"1 + 0b102",
+		"0xZZ * 2",
+		"123abc",
+		"1 + 1_000.5",
+	}
+
+	for _, s := range exprs {
+		scan := scanner.NewScanner()
+
+		scan.Tokenize(s)
+
+		parse := NewParser(scan)
+
+		parse.parseExpr()
+
+		diags := parse.Diagnostics()
+
+		if len(diags) != 1 || diags[0].Code != DIAG_MALFORMED_TOKEN {
+			t.Errorf("Expected one malformed token diagnostic for \"%s\", got %v", s, diags)
+		}
+
+		// whole literal is consumed
+		if next := scan.Peek(); next.TType == scanner.TOK_IDENT || next.TType == scanner.TOK_INTEGER {
+			t.Errorf("Expected literal to be consumed whole in \"%s\", found %v", s, next)
+		}
+	}
+}
+
+func TestIntegerLiteralValues(t *testing.T) {
+	testMap := map[string]int64{
+		"0755":    755,
+		"09":      9,
+		"0_7":     7,
+		"1_000":   1000,
+		"0x1F":    31,
+		"0o17":    15,
+		"0b1_01":  5,
+		"0":       0,
+		"007_100": 7100,
+	}
+
+	for s, expected := range testMap {
+		scan := scanner.NewScanner()
+
+		scan.Tokenize(s)
+
+		tok := scan.Advance()
+
+		literal, err := IntegerLiteralFromTok(&tok)
+
+		if err != nil {
+			t.Errorf("For \"%s\" unexpected error: %v", s, err)
+			continue
+		}
+
+		if literal.Value.Cmp(big.NewInt(expected)) != 0 {
+			t.Errorf("For \"%s\" expected %d but got %s", s, expected, literal.Value)
+		}
+	}
+}
+
+func TestIntegerOverflow(t *testing.T) {
+	files := [...]string{
+		"x : UInt8 = 255; y : Int8 = -128; z : Integer = 9223372036854775807;",
+		"x := 99999999999999999999;",
+		"x : UInt8 = 256;",
+		"x : Int8 = -129;",
+		"x : UInt64 = -1;",
+		"x : Integer = 9223372036854775808;",
+		"function f(x : UInt8 = 0x100) begin y : Int16 = 40000; end;",
+		"struct S x : UInt16 = 0x1_0000; end struct;",
+		"x : UInt8 = 256; y := ;",
+	}
+	overflows := [...]int{0, 0, 1, 1, 1, 1, 2, 1, 1}
+	errCounts := [...]int{0, 0, 1, 1, 1, 1, 2, 1, 2}
+
+	nLoops := min(len(files), len(overflows), len(errCounts))
+
+	for i := 0; i < nLoops; i++ {
+		scan := scanner.NewScanner()
+
+		scan.Tokenize(files[i])
+
+		parse := NewParser(scan)
+
+		parse.parseFile()
+
+		found := 0
+
+		for _, diag := range parse.Diagnostics() {
+			if diag.Code == DIAG_INTEGER_OVERFLOW {
+				found++
+			}
+		}
+
+		if found != overflows[i] || parse.ErrorCount() != errCounts[i] {
+			t.Errorf(
+				"Expected %d overflows and %d errors in \"%s\", got %d and %d",
+				overflows[i],
+				errCounts[i],
+				files[i],
+				found,
+				parse.ErrorCount(),
+			)
+		}
+	}
+}
+
+func TestUnterminatedBlockComment(t *testing.T) {
+	scan := scanner.NewScanner()
+
+	scan.Tokenize("/* license */\nx := 5;\n/* disabled /* nested */\ny := 6;\n")
+
+	parse := NewParser(scan)
+
+	f := parse.parseFile()
+
+	diags := parse.Diagnostics()
+
+	if len(f.definitions) != 1 || len(diags) != 1 {
+		t.Fatalf("Expected 1 definition and 1 diagnostic, got %d and %d", len(f.definitions), len(diags))
+	}
+
+	expected := SourceRange{Line: 3, Column: 1, EndColumn: 3}
+
+	if diags[0].Code != DIAG_MALFORMED_TOKEN || diags[0].Primary != expected {
+		t.Errorf("Expected diagnostic at %v, got %v", expected, diags[0])
+	}
+}
+
+func TestDocComments(t *testing.T) {
+	src := `//! Geometry helpers.
+//! Second line.
+
+/// A point.
+///   Indented.
+struct Point
+	/// Horizontal.
+	x : Integer;
+	// not doc
+	y : Integer;
+end struct;
+
+/// Colors.
+enum Color
+	/// The red one.
+	Red;
+end enum;
+
+/// Maybe a value.
+variant Option[T]
+	/// Has value.
+	Some(value : T);
+	None;
+end variant;
+
+//// not doc either
+function f() : Integer
+begin
+	/// Local.
+	x := 1;
+	return x;
+end;
+
+class C
+	/// Method.
+	function m() begin end;
+end class;
+
+/// Origin.
+origin : Integer = 0;
+`
+
+	scan := scanner.NewScanner()
+
+	scan.Tokenize(src)
+
+	parse := NewParser(scan)
+
+	f := parse.parseFile()
+
+	if parse.ErrorCount() > 0 {
+		t.Fatalf("Unexpected errors: %v", parse.Diagnostics())
+	}
+
+	if f.Doc != "Geometry helpers.\nSecond line." {
+		t.Errorf("Unexpected file doc %q", f.Doc)
+	}
+
+	if len(f.definitions) != 6 {
+		t.Fatalf("Expected 6 definitions but got %d", len(f.definitions))
+	}
+
+	point := f.definitions[0].(*StructDef)
+	color := f.definitions[1].(*EnumDef)
+	option := f.definitions[2].(*VariantDef)
+	fn := f.definitions[3].(*FunctionDef)
+	class := f.definitions[4].(*ClassDef)
+	origin := f.definitions[5].(*Definition)
+
+	local := fn.Body.(*CompoundStatement).Statements[0].(*DefinitionStatement)
+
+	checks := []struct {
+		found    string
+		expected string
+	}{
+		{point.Doc, "A point.\n  Indented."},
+		{point.Fields[0].Doc, "Horizontal."},
+		{point.Fields[1].Doc, ""},
+		{color.Doc, "Colors."},
+		{color.Members[0].Doc, "The red one."},
+		{option.Doc, "Maybe a value."},
+		{option.Alternatives[0].Doc, "Has value."},
+		{option.Alternatives[1].Doc, ""},
+		{fn.Doc, ""},
+		{local.Def.Doc, "Local."},
+		{class.Methods[0].Doc, "Method."},
+		{origin.Doc, "Origin."},
+	}
+
+	for idx, check := range checks {
+		if check.found != check.expected {
+			t.Errorf(
+				"At index %d expected doc %q but got %q",
+				idx,
+				check.expected,
+				check.found,
+			)
+		}
+	}
+}
+
+func TestStrayDocComments(t *testing.T) {
+	testStrs := []string{
+		// dangling at end of file
+		"x := 1;\n/// dangling\n",
+		// in argument list
+		"x := f(1,\n /// arg\n 2);",
+		// in parameter list
+		"function f(\n /// the x\n x : Integer) begin end;",
+		// file doc comment inside function
+		"function f() begin\n//! inner\nend;",
+		// before end of struct
+		"struct S\n\tx : Integer;\n\t/// nothing\nend struct;",
+	}
+
+	for _, s := range testStrs {
+		scan := scanner.NewScanner()
+
+		scan.Tokenize(s)
+
+		parse := NewParser(scan)
+
+		f := parse.parseFile()
+
+		if parse.ErrorCount() > 0 {
+			t.Errorf("For %q unexpected errors: %v", s, parse.Diagnostics())
+			continue
+		}
+
+		if len(f.definitions) != 1 {
+			t.Errorf(
+				"For %q expected 1 definition but got %d",
+				s,
+				len(f.definitions),
+			)
+		}
+	}
+}
+
+func TestStringEscapes(t *testing.T) {
+	testMap := map[string]string{
+		`"a\tb\n"`:               "a\tb\n",
+		`"\\ \" \0"`:             "\\ \" \x00",
+		`"\x41\xff"`:             "A\xff",
+		`"\u{e9}\u{1F600}"`:      "é\U0001F600",
+		`"\U0001F600\U000000e9"`: "\U0001F600é",
+		`"é\x7A"`:                "éz",
+		"`\\d+\\.\\d+`":          `\d+\.\d+`,
+		"`a\n\\n\"b\"`":          "a\n\\n\"b\"",
+		"\"\"\"\n    SELECT *\n      FROM t\n    \"\"\"": "SELECT *\n  FROM t\n",
+		"\"\"\"\r\n\ta\r\n\r\n\tb\\t\"\"\"":              "a\n\nb\t",
+		`"""one "quoted" line"""`:                        `one "quoted" line`,
+		"\"\"\"\n  x\n y\"\"\"":                          " x\ny",
+	}
+
+	for s, expected := range testMap {
+		tok := scanner.Token{TType: scanner.TOK_STRING, Line: 1, Column: 1, Text: s}
+
+		literal, err := StringLiteralFromTok(&tok)
+
+		if err != nil {
+			t.Errorf("For string %s got error %s", s, err)
+			continue
+		}
+
+		if literal.Text != expected {
+			t.Errorf("For string %s expected %q but got %q", s, expected, literal.Text)
+		}
+	}
+}
+
+func TestInvalidStringEscapes(t *testing.T) {
+	// column of backslash where string begins at column 3
+	testMap := map[string]int{
+		`"ab\q"`:        6,
+		`"é\x4"`:        5,
+		`"\x4g"`:        4,
+		`"ok\u{}"`:      6,
+		`"\u{110000}"`:  4,
+		`"\u{D800}"`:    4,
+		`"\u41"`:        4,
+		`"\u{1234567}"`: 4,
+		`"\U0001F60"`:   4,
+		`"\n\t\z"`:      8,
+		`"\u{41}é\xZZ"`: 11,
+	}
+
+	// multi-line strings report line and column within string
+	multiLineMap := map[string][2]int{
+		"\"\"\"\n    ok\n    \\q\n    \"\"\"": {5, 5},
+		"\"\"\"\\q\"\"\"":                     {3, 6},
+		"\"a\n\\q\"":                          {4, 1},
+	}
+
+	for s, pos := range multiLineMap {
+		src := "function f()\nbegin\n  " + s + ";\nend;\n"
+
+		scan := scanner.NewScanner()
+
+		scan.Tokenize(src)
+
+		parse := NewParser(scan)
+
+		parse.parseFile()
+
+		diags := parse.Diagnostics()
+
+		if len(diags) != 1 || diags[0].Primary.Line != pos[0] ||
+			diags[0].Primary.Column != pos[1] {
+			t.Errorf("For string %q expected single error at %v, got %v", s, pos, diags)
+		}
+	}
+
+	for s, column := range testMap {
+		src := "function f()\nbegin\n  " + s + ";\nend;\n"
+
+		scan := scanner.NewScanner()
+
+		scan.Tokenize(src)
+
+		parse := NewParser(scan)
+
+		parse.parseFile()
+
+		diags := parse.Diagnostics()
+
+		if len(diags) != 1 {
+			t.Errorf("For string %s expected 1 diagnostic, got %d", s, len(diags))
+			continue
+		}
+
+		primary := diags[0].Primary
+
+		if diags[0].Code != DIAG_INVALID_ESCAPE ||
+			primary.Line != 3 || primary.Column != column {
+			t.Errorf(
+				"For string %s expected invalid escape at 3:%d, got %s at %v",
+				s,
+				column,
+				diags[0].Code,
+				primary,
+			)
+		}
+	}
+}
+
+func TestParseInterpolatedStrings(t *testing.T) {
+	exprs := [...]string{
+		`"Hello, {name}!"`,
+		`"{a} + {b} = {a + b}"`,
+		`"x: {p.x}, y: {f(p)[0]}"`,
+		`"outer {f("inner {x}")} done"`,
+		`"tab\t{x}\{literal\}"`,
+		`"{x}"`,
+	}
+	outputs := [...]string{
+		`(interp "Hello, " name "!")`,
+		`(interp a " + " b " = " (+ a b))`,
+		`(interp "x: " p.x ", y: " ((f p) 0))`,
+		`(interp "outer " (f (interp "inner " x)) " done")`,
+		`(interp "tab\t" x "{literal}")`,
+		`(interp x)`,
+	}
+
+	for i := range exprs {
+		got, err := parseExprForTest(exprs[i])
+
+		if err != nil {
+			t.Errorf("Unexpected err while parsing %s", exprs[i])
+			continue
+		}
+
+		if got != outputs[i] {
+			t.Errorf("Expected %s, got %s", outputs[i], got)
+		}
+	}
+
+	invalidExprs := [...]string{
+		`"a {} b"`,
+		`"a {x y} b"`,
+		`"a {x} \q"`,
+		`"a {x`,
+	}
+
+	for _, s := range invalidExprs {
+		if _, err := parseExprForTest(s); err == nil {
+			t.Errorf("Expected error while parsing %s", s)
+		}
+	}
+}
+
+func TestParseCharLiterals(t *testing.T) {
+	testMap := map[string]string{
+		`'a'`:             `'a'`,
+		`'\n'`:            `'\n'`,
+		`'\''`:            `'\''`,
+		`'"'`:             `'"'`,
+		`'\u{1F600}'`:     `'😀'`,
+		`'\x41'`:          `'A'`,
+		`'\u{FFFD}'`:      `'�'`,
+		`c == 'é'`:        `(== c 'é')`,
+		`f('x', "{'y'}")`: `(f 'x' (interp 'y'))`,
+	}
+
+	for s, expected := range testMap {
+		got, err := parseExprForTest(s)
+
+		if err != nil {
+			t.Errorf("Unexpected err while parsing %s", s)
+			continue
+		}
+
+		if got != expected {
+			t.Errorf("For %s expected %s, got %s", s, expected, got)
+		}
+	}
+
+	invalidExprs := [...]string{
+		`''`,
+		`'ab'`,
+		`'\q'`,
+		`'\xff'`,
+		`'\u{D800}'`,
+	}
+
+	for _, s := range invalidExprs {
+		if _, err := parseExprForTest(s); err == nil {
+			t.Errorf("Expected error while parsing %s", s)
+		}
+	}
+}
+
+func TestInputError(t *testing.T) {
+	scan := scanner.NewScanner()
+
+	scan.TokenizeFile(filepath.Join(t.TempDir(), "missing.pgs"))
+
+	parse := NewParser(scan)
+
+	parse.parseFile()
+
+	diags := parse.Diagnostics()
+
+	var fileErr *scanner.FileError
+
+	if len(diags) != 1 || diags[0].Code != DIAG_INPUT_ERROR ||
+		!errors.As(diags[0].Err, &fileErr) || !errors.Is(fileErr, fs.ErrNotExist) {
+		t.Errorf("Expected single input error, got %v", diags)
+	}
+}
+
+func TestMalformedFloat(t *testing.T) {
+	if _, err := parseExprForTest("1.0e400"); err == nil {
+		t.Errorf("Expected error for out of range float")
+	}
+}
+
+func TestSpans(t *testing.T) {
+	src := `/// Doc.
+function f(a : Integer, b := 2) : Integer
+begin
+	x := -a + g(b, c = 1).y;
+	y := (1 + 2) * 3 + (a).b;
+	if x < 0 x = 0; end if;
+	return "s{x}!";
+end;
+
+enum E A = 1; end enum;
+`
+
+	scan := scanner.NewScanner()
+
+	scan.Tokenize(src)
+
+	parse := NewParser(scan)
+
+	f := parse.parseFile()
+
+	if parse.ErrorCount() > 0 {
+		t.Fatalf("Unexpected errors: %v", parse.Diagnostics())
+	}
+
+	text := func(node interface {
+		Span() (scanner.Pos, scanner.Pos)
+	}) string {
+		start, end := node.Span()
+
+		return src[start.Offset():end.Offset()]
+	}
+
+	fn := f.definitions[0].(*FunctionDef)
+	body := fn.Body.(*CompoundStatement)
+	def := body.Statements[0].(*DefinitionStatement)
+	value := def.Def.Value.(*BinaryExpr)
+	parens := body.Statements[1].(*DefinitionStatement).Def.Value.(*BinaryExpr)
+	ifStmt := body.Statements[2].(*IfStatement)
+	ret := body.Statements[3].(*ReturnStatement)
+	interp := ret.Value.(*InterpolatedStringExpr)
+	enum := f.definitions[1].(*EnumDef)
+
+	testCases := []struct {
+		got      string
+		expected string
+	}{
+		{text(f), src},
+		{text(fn), src[len("/// Doc.\n") : strings.Index(src, "end;")+len("end;")]},
+		{text(&fn.Params), "a : Integer, b := 2"},
+		{text(&fn.Params.ParamList[1]), "b := 2"},
+		{text(fn.ReturnType), "Integer"},
+		{text(def), "x := -a + g(b, c = 1).y;"},
+		{text(def.Def), "x := -a + g(b, c = 1).y"},
+		{text(value), "-a + g(b, c = 1).y"},
+		{text(value.Lhs), "-a"},
+		{text(value.Rhs), "g(b, c = 1).y"},
+		{text(parens), "(1 + 2) * 3 + (a).b"},
+		{text(parens.Lhs), "(1 + 2) * 3"},
+		{text(parens.Rhs), "(a).b"},
+		{text(ifStmt), "if x < 0 x = 0; end if;"},
+		{text(ifStmt.IfThens[0].Body), "x = 0;"},
+		{text(ret), `return "s{x}!";`},
+		{text(interp), `"s{x}!"`},
+		{text(interp.Parts[0]), "s"},
+		{text(interp.Parts[1]), "x"},
+		{text(enum), "enum E A = 1; end enum;"},
+		{text(&enum.Members[0]), "A = 1"},
+	}
+
+	for _, tc := range testCases {
+		if tc.got != tc.expected {
+			t.Errorf("Expected span of %q but got %q", tc.expected, tc.got)
+		}
+	}
+}
+
+func TestLexicalErrors(t *testing.T) {
+	src := `x := 1 @ 2 $ 3;
+function f() : Integer
+begin
+	t := "a {s
+	s := "abc;
+	c := 'q;
+	return # 0;
+end;
+struct P
+	?
+	y : Integer;
+end struct;
+`
+
+	expected := []string{
+		"unexpected character '@'",
+		"unexpected character '$'",
+		"unterminated expression in string",
+		"unterminated string literal",
+		"unterminated character literal",
+		"unexpected character '#'",
+		"unexpected character '?'",
+	}
+
+	scan := scanner.NewScanner()
+
+	scan.Tokenize(src)
+
+	parse := NewParser(scan)
+
+	f := parse.parseFile()
+
+	var messages []string
+
+	for _, diag := range parse.Diagnostics() {
+		var parseErr *ParseError
+
+		if !errors.As(diag.Err, &parseErr) || diag.Code != DIAG_MALFORMED_TOKEN {
+			t.Errorf("Unexpected diagnostic %v", diag.Err)
+			continue
+		}
+
+		messages = append(messages, parseErr.Message)
+	}
+
+	if strings.Join(messages, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected errors %q but got %q", expected, messages)
+	}
+
+	// parsing resumed after each error
+	if len(f.definitions) != 3 {
+		t.Errorf("Expected 3 definitions but got %d", len(f.definitions))
+	}
+}
@@ -0,0 +1,136 @@
+package parser
+
+import (
+	"strings"
+)
+
+func paramToString(param *Param) string {
+	if param.InferType && !param.HasDefault {
+		return param.Name
+	}
+	if param.InferType {
+		return "(:= " + param.Name + " " + ExprToString(param.Default) + ")"
+	}
+
+	s := "(: " + param.Name + " " + ExprToString(param.Type)
+
+	if param.HasDefault {
+		s += (" " + ExprToString(param.Default))
+	}
+
+	return s + ")"
+}
+
+func templateParamsToString(params []TemplateParam) string {
+	strs := make([]string, len(params))
+
+	for i, param := range params {
+		if param.HasType {
+			strs[i] = "(: " + param.Name + " " + ExprToString(param.Type) + ")"
+		} else {
+			strs[i] = param.Name
+		}
+	}
+
+	return "(" + strings.Join(strs, " ") + ")"
+}
+
+func fieldsToString(fields []Field) string {
+	strs := make([]string, len(fields))
+
+	for i, field := range fields {
+		strs[i] = paramToString(&field.Param)
+	}
+
+	return "(" + strings.Join(strs, " ") + ")"
+}
+
+func paramsToString(params *Params) string {
+	strs := make([]string, len(params.ParamList))
+
+	for i, param := range params.ParamList {
+		strs[i] = paramToString(&param)
+	}
+
+	return "(" + strings.Join(strs, " ") + ")"
+}
+
+func DefinitionToString(def IDefinition) string {
+	s := ""
+
+	switch def := def.(type) {
+	case *Definition:
+		if def.InferType {
+			s = "(:= " + def.Name() + " " + ExprToString(def.Value) + ")"
+		} else {
+			s = "(: " + def.Name() + " " +
+				ExprToString(def.Type) + " " +
+				ExprToString(def.Value) + ")"
+		}
+	case *FunctionDef:
+		returnType := "_"
+
+		if def.HasReturnType {
+			returnType = ExprToString(def.ReturnType)
+		}
+
+		s = "(function " + def.Name() + " " +
+			paramsToString(&def.Params) + " " +
+			returnType + " " +
+			StatementToString(def.Body) + ")"
+	case *StructDef:
+		s = "(struct " + def.Name() + " " +
+			templateParamsToString(def.TemplateParams) + " " +
+			fieldsToString(def.Fields) + ")"
+	case *ClassDef:
+		methodStrs := make([]string, len(def.Methods))
+
+		for i, method := range def.Methods {
+			methodStrs[i] = DefinitionToString(method)
+		}
+
+		s = "(class " + def.Name() + " " +
+			templateParamsToString(def.TemplateParams) + " " +
+			fieldsToString(def.Fields) +
+			" (" + strings.Join(methodStrs, " ") + "))"
+	case *EnumDef:
+		memberStrs := make([]string, len(def.Members))
+
+		for i, member := range def.Members {
+			if member.HasValue {
+				memberStrs[i] = "(" + member.Name + " " +
+					ExprToString(member.Value) + ")"
+			} else {
+				memberStrs[i] = member.Name
+			}
+		}
+
+		s = "(enum " + def.Name() +
+			" (" + strings.Join(memberStrs, " ") + "))"
+	case *VariantDef:
+		altStrs := make([]string, len(def.Alternatives))
+
+		for i, alt := range def.Alternatives {
+			if len(alt.Fields) > 0 {
+				fields := fieldsToString(alt.Fields)
+
+				// drop parens around fields, e.g. (Some (: value T))
+				altStrs[i] = "(" + alt.Name + " " +
+					fields[1:len(fields)-1] + ")"
+			} else {
+				altStrs[i] = alt.Name
+			}
+		}
+
+		s = "(variant " + def.Name() + " " +
+			templateParamsToString(def.TemplateParams) +
+			" (" + strings.Join(altStrs, " ") + "))"
+	default:
+	}
+
+	if s == "" {
+		return "ERR"
+	}
+
+	return s
+}
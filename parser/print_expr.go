@@ -37,11 +37,22 @@ func ExprToString(expr IExpr) string {
 		)
 	case *StringLiteral:
 		s = expr.Text
+	case *CharLiteral:
+		s = strconv.QuoteRune(expr.Value)
+	case *InterpolatedStringExpr:
+		s = "(interp"
+
+		for _, part := range expr.Parts {
+			if literal, ok := part.(*StringLiteral); ok {
+				s += (" " + strconv.Quote(literal.Text))
+			} else {
+				s += (" " + ExprToString(part))
+			}
+		}
+
+		s += ")"
 	case *IntegerLiteral:
-		s = strconv.FormatUint(
-			expr.Value,
-			10,
-		)
+		s = expr.Value.String()
 	case *IdentExpr:
 		s = strings.Join(expr.Names, "::")
 	case *FunctionCallExpr:
@@ -63,6 +74,23 @@ func ExprToString(expr IExpr) string {
 	case *MemberAccessExpr:
 		s = ExprToString(expr.Instance) +
 			"." + expr.Member
+	case *LambdaExpr:
+		returnType := "_"
+
+		if expr.HasReturnType {
+			returnType = ExprToString(expr.ReturnType)
+		}
+
+		body := ""
+
+		if expr.IsExprBody {
+			body = ExprToString(expr.BodyExpr)
+		} else {
+			body = StatementToString(expr.Body)
+		}
+
+		s = "(lambda " + paramsToString(&expr.Params) + " " +
+			returnType + " " + body + ")"
 	default:
 	}
 
@@ -0,0 +1,91 @@
+package parser
+
+import (
+	"strings"
+)
+
+// "_" is used for omitted optional components
+func optStatementToString(statement IStatement, present bool) string {
+	if !present {
+		return "_"
+	}
+
+	return StatementToString(statement)
+}
+
+func StatementToString(statement IStatement) string {
+	s := ""
+
+	switch statement := statement.(type) {
+	case *DefinitionStatement:
+		s = DefinitionToString(statement.Def)
+	case *ExprStatement:
+		s = ExprToString(statement.Expr)
+	case *ModifyVarStatement:
+		s = "(" + statement.Operator.TType.Text() + " " +
+			ExprToString(statement.Var) + " " +
+			ExprToString(statement.Rhs) + ")"
+	case *ReturnStatement:
+		s = "(return"
+
+		if statement.HasValue {
+			s += (" " + ExprToString(statement.Value))
+		}
+
+		s += ")"
+	case *IncDecStatement:
+		op := "--"
+
+		if statement.IsInc {
+			op = "++"
+		}
+
+		s = "(" + op + " " + ExprToString(statement.Var) + ")"
+	case *CompoundStatement:
+		strs := make([]string, len(statement.Statements))
+
+		for i, sub := range statement.Statements {
+			strs[i] = StatementToString(sub)
+		}
+
+		s = "(begin"
+
+		if len(strs) > 0 {
+			s += (" " + strings.Join(strs, " "))
+		}
+
+		s += ")"
+	case *LoopStatement:
+		condition := "_"
+
+		if statement.HasCondition {
+			condition = ExprToString(statement.Condition)
+		}
+
+		s = "(loop " +
+			optStatementToString(statement.Before, statement.HasBefore) + " " +
+			condition + " " +
+			optStatementToString(statement.After, statement.HasAfter) + " " +
+			StatementToString(statement.Body) + ")"
+	case *IfStatement:
+		s = "(if"
+
+		for _, ifThen := range statement.IfThens {
+			s += (" (" + ExprToString(ifThen.Condition) + " " +
+				StatementToString(ifThen.Body) + ")")
+		}
+
+		if statement.HasElse {
+			s += (" (else " + StatementToString(statement.Else) + ")")
+		}
+
+		s += ")"
+	default:
+	}
+
+	if s == "" {
+		return "ERR"
+	}
+
+	return s
+}
@@ -1,28 +1,53 @@
 package parser
 
 import (
+	"context"
 	"pegasus/scanner"
+	"sync"
 	"sync/atomic"
 )
 
 type Parser struct {
+	ctx context.Context
+
 	scan *scanner.Scanner
 
 	nodeChan *chan INode
-	errChan  *chan ParseError
+
+	diagMutex   sync.Mutex
+	diagnostics []Diagnostic
+
+	// true => MAX_PARSE_ERRORS was exceeded and errors were dropped
+	truncated bool
 
 	errCount atomic.Uint32
+
+	// true => error was found and parser has not yet resynchronized,
+	// further errors are not reported until it does
+	panicking bool
+
+	// last TOK_FAILURE reported, so that it is not reported again when
+	// skipped by synchronize
+	lastFailure scanner.Pos
 }
 
 type ParseError struct {
+	Code DiagnosticCode
+
+	// shown as label, e.g. "warning:", set when reported
+	Severity Severity
+
 	Expected scanner.TokenType
 	Found    scanner.Token
 
 	ExpectedNode INode
 
 	Message string
-}
 
-func (err *ParseError) Error() string {
-	return ""
+	// e.g. start of construct which was not properly ended
+	Related []SourceRange
+
+	// used to show where error occurred
+	Filename   string
+	SourceLine string
 }
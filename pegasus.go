@@ -1,7 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"os"
+	"pegasus/doc"
+	"pegasus/parser"
 	"pegasus/scanner"
 )
 
@@ -13,11 +19,97 @@ func main() {
 	args := flag.Args()
 	nargs := len(args)
 
+	if nargs > 0 && args[0] == "doc" {
+		os.Exit(runDoc(args[1:]))
+	}
+
 	if nargs > 0 {
 		filename = args[0]
 	}
 
 	scan := scanner.NewScanner()
 
-	scan.TokenizeFile(filename)
+	// "-" => read source from stdin
+	if filename == "-" {
+		scan.TokenizeReader(os.Stdin)
+	} else if err := scan.TokenizeFile(filename); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	os.Exit(runParse(scan))
+}
+
+// parse input of scan, writing diagnostics to stderr,
+// returns exit status
+func runParse(scan *scanner.Scanner) int {
+	parse := parser.NewParser(scan)
+
+	parse.Parse()
+
+	for range parse.Nodes() {
+	}
+
+	status := 0
+
+	for _, diag := range parse.Diagnostics() {
+		var parseErr *parser.ParseError
+
+		if errors.As(diag.Err, &parseErr) {
+			parser.WriteError(os.Stderr, parseErr)
+		} else {
+			fmt.Fprintln(os.Stderr, diag.Err)
+		}
+
+		if diag.Severity == parser.SEVERITY_ERROR {
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// pegasus doc [-format html|markdown] [-o dir] [source dir],
+// returns exit status
+func runDoc(args []string) int {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+
+	formatStr := flags.String("format", "html", "output format (html or markdown)")
+	outDir := flags.String("o", "docs", "output directory")
+
+	flags.Parse(args)
+
+	format, ok := doc.ParseFormat(*formatStr)
+
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown doc format %q\n", *formatStr)
+		return 2
+	}
+
+	root := "."
+
+	if flags.NArg() > 0 {
+		root = flags.Arg(0)
+	}
+
+	status := 0
+
+	site, err := doc.Load(context.Background(), root)
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		status = 1
+	}
+
+	// files which could not be parsed are missing, rest are documented
+	if site == nil {
+		return status
+	}
+
+	if err := site.Write(*outDir, format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	return status
 }
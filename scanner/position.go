@@ -0,0 +1,221 @@
+package scanner
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"unicode/utf8"
+)
+
+// low bits of Pos hold byte offset in file, so files may be up to 1 TiB
+const POS_OFFSET_BITS = 40
+
+// Compact source position, ID of file in FileSet (high bits) and byte
+// offset in that file (low bits). IDs start at 1 so that zero is NoPos.
+type Pos uint64
+
+const NoPos Pos = 0
+
+func MakePos(fileID int, offset int) Pos {
+	return Pos(fileID)<<POS_OFFSET_BITS | Pos(offset)
+}
+
+func (pos Pos) FileID() int {
+	return int(pos >> POS_OFFSET_BITS)
+}
+
+func (pos Pos) Offset() int {
+	return int(pos & (1<<POS_OFFSET_BITS - 1))
+}
+
+func (pos Pos) IsValid() bool {
+	return pos.FileID() != 0
+}
+
+// Position resolved from Pos, Line and Column are 1-indexed
+// (Column counts runes, as Token.Column does)
+type Position struct {
+	Filename string
+	Offset   int
+	Line     int
+	Column   int
+}
+
+func (position Position) IsValid() bool {
+	return position.Line > 0
+}
+
+// e.g. main.pgs:3:9, or 3:9 without filename
+func (position Position) String() string {
+	if !position.IsValid() {
+		return "-"
+	}
+
+	s := fmt.Sprintf("%d:%d", position.Line, position.Column)
+
+	if position.Filename != "" {
+		s = position.Filename + ":" + s
+	}
+
+	return s
+}
+
+// Source file registered in FileSet. Its line table grows as text is
+// read, so positions resolve while file is still being scanned.
+type SourceFile struct {
+	id   int
+	name string
+
+	mutex sync.Mutex
+
+	// byte offsets of line starts, first is always 0
+	lines []int
+
+	// byte offsets of multi-byte runes and, for each, total bytes beyond
+	// the first of it and those before it, so that byte offsets may be
+	// turned into rune columns
+	wide      []int
+	wideExtra []int
+
+	// bytes added so far
+	size int
+}
+
+func (file *SourceFile) ID() int {
+	return file.id
+}
+
+// filename, empty for input given as string or reader
+func (file *SourceFile) Name() string {
+	return file.name
+}
+
+func (file *SourceFile) Size() int {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	return file.size
+}
+
+func (file *SourceFile) Pos(offset int) Pos {
+	return MakePos(file.id, offset)
+}
+
+// record text appended to file, adding its line starts
+func (file *SourceFile) addText(text string) {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	for i := 0; i < len(text); {
+		if text[i] == '\n' {
+			file.lines = append(file.lines, file.size+i+1)
+		}
+
+		_, bytes := utf8.DecodeRuneInString(text[i:])
+
+		if bytes > 1 {
+			file.wide = append(file.wide, file.size+i)
+			file.wideExtra = append(file.wideExtra, file.extraBefore(file.size+i)+bytes-1)
+		}
+
+		i += bytes
+	}
+
+	file.size += len(text)
+}
+
+// position of byte offset in file
+func (file *SourceFile) Position(offset int) Position {
+	file.mutex.Lock()
+	defer file.mutex.Unlock()
+
+	// index of last line starting at or before offset
+	line := sort.Search(len(file.lines), func(i int) bool {
+		return file.lines[i] > offset
+	}) - 1
+
+	lineStart := file.lines[line]
+
+	return Position{
+		Filename: file.name,
+		Offset:   offset,
+		Line:     line + 1,
+		Column: offset - lineStart -
+			(file.extraBefore(offset) - file.extraBefore(lineStart)) + 1,
+	}
+}
+
+// bytes beyond the first of multi-byte runes before offset
+func (file *SourceFile) extraBefore(offset int) int {
+	idx := sort.SearchInts(file.wide, offset)
+
+	if idx == 0 {
+		return 0
+	}
+
+	return file.wideExtra[idx-1]
+}
+
+// Registry of source files, so that Pos values from several files may be
+// resolved (e.g. for diagnostics across files). Safe for concurrent use.
+type FileSet struct {
+	mutex sync.Mutex
+	files []*SourceFile
+}
+
+func NewFileSet() *FileSet {
+	return &FileSet{}
+}
+
+// register new file, text is recorded as it is scanned
+func (fset *FileSet) AddFile(name string) *SourceFile {
+	return fset.replaceFile(nil, name)
+}
+
+// new file in place of file (taking its ID), e.g. when input of scanner
+// is replaced, so that re-scanning does not grow fset. Positions in file
+// then resolve in new one. New file is added if file is not in fset.
+func (fset *FileSet) replaceFile(file *SourceFile, name string) *SourceFile {
+	fset.mutex.Lock()
+	defer fset.mutex.Unlock()
+
+	ret := &SourceFile{
+		id:    len(fset.files) + 1,
+		name:  name,
+		lines: []int{0},
+	}
+
+	if file != nil && file.id <= len(fset.files) && fset.files[file.id-1] == file {
+		ret.id = file.id
+		fset.files[ret.id-1] = ret
+	} else {
+		fset.files = append(fset.files, ret)
+	}
+
+	return ret
+}
+
+// file which pos is in, nil if not found
+func (fset *FileSet) File(pos Pos) *SourceFile {
+	fset.mutex.Lock()
+	defer fset.mutex.Unlock()
+
+	id := pos.FileID()
+
+	if id < 1 || id > len(fset.files) {
+		return nil
+	}
+
+	return fset.files[id-1]
+}
+
+// resolve pos, invalid Position if its file is not found
+func (fset *FileSet) Position(pos Pos) Position {
+	file := fset.File(pos)
+
+	if file == nil {
+		return Position{}
+	}
+
+	return file.Position(pos.Offset())
+}
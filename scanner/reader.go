@@ -0,0 +1,138 @@
+package scanner
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// minimum number of bytes read from reader at once
+const READ_CHUNK_SIZE = 64 * 1024
+
+// Token ending within this many bytes of end of input read so far may
+// continue in unread input (e.g. 1.5 split as 1. and 5), so more is read
+// and it is scanned again
+const READ_MARGIN = 16
+
+// position of scanner in src, restored to rescan token after reading more
+type scanState struct {
+	offset      int
+	line        int
+	column      int
+	done        bool
+	interpDepth int
+}
+
+func (scanner *Scanner) state() scanState {
+	return scanState{
+		offset:      scanner.offset,
+		line:        scanner.line,
+		column:      scanner.column,
+		done:        scanner.done,
+		interpDepth: scanner.interpDepth,
+	}
+}
+
+func (scanner *Scanner) restore(state scanState) {
+	scanner.offset = state.offset
+	scanner.line = state.line
+	scanner.column = state.column
+	scanner.done = state.done
+	scanner.interpDepth = state.interpDepth
+}
+
+// true => tok was scanned from incomplete input and so must be scanned
+// again after reading more
+func (scanner *Scanner) needsMore(tok *Token) bool {
+	if scanner.reader == nil || scanner.readerDone || scanner.ctx.Err() != nil {
+		return false
+	}
+
+	if tok.TType == TOK_EOF || isUnterminated(tok) {
+		return true
+	}
+
+	return scanner.offset+READ_MARGIN > len(scanner.src)
+}
+
+// read next chunk of input into src, first dropping lines before offset
+// once enough have been scanned
+func (scanner *Scanner) fill() {
+	// reading at least as much as is held keeps rescanning of long
+	// tokens linear
+	buf := make([]byte, max(READ_CHUNK_SIZE, len(scanner.src)-scanner.offset))
+
+	n, err := 0, error(nil)
+
+	for n == 0 && err == nil {
+		n, err = scanner.reader.Read(buf)
+	}
+
+	data := append(scanner.pending, buf[:n]...)
+
+	scanner.pending = nil
+
+	if err != nil {
+		scanner.readerDone = true
+
+		if err != io.EOF && scanner.filename != "" {
+			scanner.setErr(&FileError{Filename: scanner.filename, Err: err})
+		} else if err != io.EOF {
+			scanner.setErr(err)
+		}
+
+		scanner.closeReader()
+	} else if keep := incompleteRuneSuffix(data); keep > 0 {
+		scanner.pending = append([]byte(nil), data[len(data)-keep:]...)
+		data = data[:len(data)-keep]
+	}
+
+	text := string(data)
+
+	scanner.file.addText(text)
+
+	scanner.srcMutex.Lock()
+	defer scanner.srcMutex.Unlock()
+
+	// keep whole lines so that SourceLine can show them
+	cut := 0
+
+	if scanner.offset >= READ_CHUNK_SIZE {
+		cut = strings.LastIndexByte(scanner.src[:scanner.offset], '\n') + 1
+	}
+
+	scanner.srcLine += strings.Count(scanner.src[:cut], "\n")
+	scanner.srcBase += cut
+	scanner.src = scanner.src[cut:] + text
+	scanner.offset -= cut
+}
+
+// number of bytes at end of data which begin UTF-8 sequence
+// but do not complete it
+func incompleteRuneSuffix(data []byte) int {
+	dataLen := len(data)
+
+	for i := 1; i <= min(utf8.UTFMax-1, dataLen); i++ {
+		if !utf8.RuneStart(data[dataLen-i]) {
+			continue
+		}
+
+		if utf8.FullRune(data[dataLen-i:]) {
+			return 0
+		}
+
+		return i
+	}
+
+	return 0
+}
+
+// close reader if scanner opened it
+func (scanner *Scanner) closeReader() {
+	if scanner.closer == nil {
+		return
+	}
+
+	scanner.closer.Close()
+	scanner.closer = nil
+}
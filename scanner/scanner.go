@@ -1,7 +1,10 @@
 package scanner
 
 import (
-	"log"
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
 	"strings"
 	"unicode"
@@ -10,6 +13,21 @@ import (
 
 const MAX_BUFFERED_TOKENS = 1000000
 
+// delimits multi-line string
+const TRIPLE_QUOTE = `"""`
+
+// reasons of TOK_FAILURE tokens, besides unexpected characters
+const (
+	REASON_UNTERMINATED_STRING  = "unterminated string literal"
+	REASON_UNTERMINATED_CHAR    = "unterminated character literal"
+	REASON_UNTERMINATED_COMMENT = "unterminated block comment"
+	REASON_MALFORMED_INTEGER    = "malformed integer literal"
+	REASON_MALFORMED_FLOAT      = "malformed float literal"
+
+	// e.g. "Hello, {name at end of line
+	REASON_UNTERMINATED_INTERPOLATION = "unterminated expression in string"
+)
+
 const (
 	TOK_EOF TokenType = iota
 	TOK_FAILURE
@@ -26,10 +44,13 @@ const (
 	TOK_ENUM
 	TOK_VARIANT
 	TOK_IF
+	TOK_ELSIF
+	TOK_ELSE
 	TOK_FOR
 	TOK_WHILE
 	TOK_BEGIN
 	TOK_END
+	TOK_RETURN
 	TOK_GT
 	TOK_LT
 	TOK_GE
@@ -49,6 +70,7 @@ const (
 	TOK_PLUS_PLUS
 	TOK_MINUS_MINUS
 	TOK_EQ_EQ
+	TOK_EQ_GT
 	TOK_LT_LT
 	TOK_GT_GT
 	TOK_PERCENT
@@ -73,6 +95,12 @@ const (
 	TOK_IDENT
 	TOK_INTEGER
 	TOK_FLOAT
+	TOK_DOC_COMMENT
+	TOK_FILE_DOC_COMMENT
+	TOK_STRING_START
+	TOK_STRING_MIDDLE
+	TOK_STRING_END
+	TOK_CHAR
 )
 
 var TokStrings = [...]string{
@@ -84,6 +112,8 @@ var TokStrings = [...]string{
 	TOK_COMMA:        ",",
 	TOK_FUNCTION:     "function",
 	TOK_IF:           "if",
+	TOK_ELSIF:        "elsif",
+	TOK_ELSE:         "else",
 	TOK_WHILE:        "while",
 	TOK_AMPERSAND:    "&",
 	TOK_CARROT:       "^",
@@ -101,6 +131,7 @@ var TokStrings = [...]string{
 	TOK_FOR:          "for",
 	TOK_BEGIN:        "begin",
 	TOK_END:          "end",
+	TOK_RETURN:       "return",
 	TOK_STAR:         "*",
 	TOK_F_SLASH:      "/",
 	TOK_PERIOD:       ".",
@@ -128,6 +159,7 @@ var TokStrings = [...]string{
 	TOK_COLON:        ":",
 	TOK_COLON_EQ:     ":=",
 	TOK_EQ_EQ:        "==",
+	TOK_EQ_GT:        "=>",
 	TOK_BANG_EQ:      "!=",
 	TOK_NOT:          "not",
 	TOK_AND:          "and",
@@ -153,6 +185,8 @@ var TokDescs = [...]string{
 	TOK_FUNCTION:     "Function ('function')",
 	TOK_LAMBDA:       "Lambda ('lambda')",
 	TOK_IF:           "If ('if')",
+	TOK_ELSIF:        "Else If ('elsif')",
+	TOK_ELSE:         "Else ('else')",
 	TOK_FOR:          "For ('for')",
 	TOK_WHILE:        "While ('while')",
 	TOK_STRUCT:       "Struct ('struct')",
@@ -161,6 +195,7 @@ var TokDescs = [...]string{
 	TOK_VARIANT:      "Variant ('variant')",
 	TOK_BEGIN:        "Begin ('begin')",
 	TOK_END:          "End ('end')",
+	TOK_RETURN:       "Return ('return')",
 	TOK_GT:           "Greater Than ('>')",
 	TOK_LT:           "Less Than ('<')",
 	TOK_GE:           "Greater Than Or Equal To ('>=')",
@@ -180,6 +215,7 @@ var TokDescs = [...]string{
 	TOK_PLUS_PLUS:    "Increment ('++')",
 	TOK_MINUS_MINUS:  "Decrement ('--')",
 	TOK_EQ_EQ:        "Equal To ('==')",
+	TOK_EQ_GT:        "Arrow ('=>')",
 	TOK_COLON_EQ:     "Assign + Infer Type (':=')",
 	TOK_BANG_EQ:      "Not Equal To ('!=')",
 	TOK_NOT:          "Not ('not')",
@@ -196,6 +232,15 @@ var TokDescs = [...]string{
 	TOK_IDENT:        "Identifier",
 	TOK_INTEGER:      "Integer",
 	TOK_FLOAT:        "Floating-Point Number",
+
+	TOK_DOC_COMMENT:      "Doc Comment ('///')",
+	TOK_FILE_DOC_COMMENT: "File Doc Comment ('//!')",
+
+	TOK_STRING_START:  "Start of Interpolated String",
+	TOK_STRING_MIDDLE: "Middle of Interpolated String",
+	TOK_STRING_END:    "End of Interpolated String",
+
+	TOK_CHAR: "Character Literal",
 }
 
 func (ttype TokenType) Text() string {
@@ -214,24 +259,41 @@ func (ttype TokenType) Desc() string {
 	return TokDescs[ttype]
 }
 
-func (scanner *Scanner) initScanner() {
-	tChan := make(chan Token, MAX_BUFFERED_TOKENS)
-
-	scanner.tChan = &tChan
-	scanner.isEof = true
+// Pos just past last byte of token
+func (tok Token) End() Pos {
+	return tok.Pos + Pos(tok.Width)
+}
 
+func (scanner *Scanner) initScanner() {
 	scanner.line = 1
 	scanner.column = 1
+	scanner.srcLine = 1
+	scanner.interpDepth = 0
 }
 
+// scanner which scans tokens lazily as they are requested
 func NewScanner() *Scanner {
 	var ret Scanner
 
 	ret.initScanner()
 
+	ret.ctx = context.Background()
+
 	return &ret
 }
 
+// scanner which scans tokens in separate goroutine, buffering up to
+// MAX_BUFFERED_TOKENS tokens for consumer
+func NewPipelineScanner() *Scanner {
+	ret := NewScanner()
+
+	tChan := make(chan Token, MAX_BUFFERED_TOKENS)
+
+	ret.tChan = &tChan
+
+	return ret
+}
+
 func (scanner *Scanner) token(ttype TokenType) Token {
 	tstr := ""
 	tstrlen := 0
@@ -248,154 +310,591 @@ func (scanner *Scanner) token(ttype TokenType) Token {
 		Column: scanner.column,
 		Width:  tstrlen,
 		Text:   tstr,
+		Pos:    scanner.posAt(scanner.offset),
 	}
 }
 
-func (scanner *Scanner) fillCache() {
-	if scanner.isCacheFilled {
-		return
-	}
+// get token from pipeline goroutine or by scanning it now
+func (scanner *Scanner) pull() Token {
+	var tok Token
+
 	if scanner.tChan == nil {
-		scanner.initScanner()
+		tok = scanner.scanNext()
+	} else if scanner.pipelineDone {
+		tok = scanner.eofTok
+	} else {
+		select {
+		case tok = <-*scanner.tChan:
+		case <-scanner.ctx.Done():
+			tok = Token{TType: TOK_EOF}
+		}
+
+		if tok.TType == TOK_EOF {
+			scanner.pipelineDone = true
+			scanner.eofTok = tok
+		}
 	}
 
-	scanner.isCacheFilled = true
+	if tok.TType == TOK_EOF {
+		scanner.setErr(scanner.ctx.Err())
+	}
 
-	// should always get at least one TOK_EOF
-	scanner.peek = <-*scanner.tChan
+	return tok
+}
 
-	if scanner.peek.TType == TOK_EOF {
-		scanner.isEof = true
-	} else {
-		// if did not find eof, then should be another token
-		// available at some point
-		scanner.peek2 = <-*scanner.tChan
+// error which ended scanning early (i.e. from cancelled context or failure
+// to read input), else nil
+func (scanner *Scanner) Err() error {
+	scanner.errMutex.Lock()
+	defer scanner.errMutex.Unlock()
+
+	return scanner.err
+}
+
+// record err as having ended scanning unless an earlier error did, e.g.
+// read error in pipeline goroutine before consumer sees cancellation
+func (scanner *Scanner) setErr(err error) {
+	scanner.errMutex.Lock()
+	defer scanner.errMutex.Unlock()
+
+	if scanner.err == nil {
+		scanner.err = err
 	}
 }
 
-func (scanner *Scanner) Advance() Token {
-	// attempt to load first two tokens if not already done
+// ensure at least n tokens are in lookahead
+func (scanner *Scanner) fillLookahead(n int) {
+	for len(scanner.lookahead) < n {
+		scanner.lookahead = append(scanner.lookahead, scanner.pull())
+	}
+}
 
-	scanner.fillCache()
+// index in lookahead of nth (from 1) token Peek/Advance return, which
+// passes over doc comments if scanner skips them
+func (scanner *Scanner) lookaheadIndex(n int) int {
+	for idx := 0; ; idx++ {
+		scanner.fillLookahead(idx + 1)
 
-	ret := scanner.peek
+		if scanner.skipDoc && isDocToken(scanner.lookahead[idx].TType) {
+			continue
+		}
 
-	var chanTok Token
+		n--
 
-	if scanner.isEof {
-		select {
-		case chanTok = <-*scanner.tChan:
-			scanner.isEof = false
-		default: // still EOF
-			return ret
+		if n == 0 {
+			return idx
 		}
-	} else if scanner.peek2.TType != TOK_EOF {
-		// if second cached tok is not EOF then attempt to get another
-		chanTok = <-*scanner.tChan
 	}
+}
+
+func (scanner *Scanner) Advance() Token {
+	idx := scanner.lookaheadIndex(1)
 
-	scanner.peek = scanner.peek2
-	scanner.peek2 = chanTok
+	ret := scanner.lookahead[idx]
 
-	if scanner.peek.TType == TOK_EOF {
-		scanner.isEof = true
+	// TOK_EOF remains until input is replaced
+	if ret.TType != TOK_EOF {
+		idx++
 	}
 
+	scanner.lookahead = scanner.lookahead[idx:]
+
+	scanner.lastEnd = ret.End()
+
 	return ret
 }
 
-func (scanner *Scanner) Peek() Token {
-	scanner.fillCache()
+// Returns next token, only scanning it when called (in scanner from
+// NewScanner). Unlike Advance, no tokens are scanned ahead, though any
+// already scanned by Peek/PeekSecond are returned first.
+func (scanner *Scanner) Next() Token {
+	if len(scanner.lookahead) > 0 {
+		return scanner.Advance()
+	}
+
+	ret := scanner.pull()
+
+	for scanner.skipDoc && isDocToken(ret.TType) {
+		ret = scanner.pull()
+	}
+
+	scanner.lastEnd = ret.End()
 
-	return scanner.peek
+	return ret
+}
+
+// Pos after last token returned by Advance or Next, e.g. end of node
+// whose last token was just consumed
+func (scanner *Scanner) LastEnd() Pos {
+	return scanner.lastEnd
+}
+
+func (scanner *Scanner) Peek() Token {
+	return scanner.lookahead[scanner.lookaheadIndex(1)]
 }
 
 // returns the token after the one Peek() returns
 func (scanner *Scanner) PeekSecond() Token {
-	scanner.fillCache()
+	return scanner.lookahead[scanner.lookaheadIndex(2)]
+}
+
+// returns next token even if it is a doc comment which Peek passes over
+func (scanner *Scanner) PeekDocComment() Token {
+	scanner.fillLookahead(1)
+
+	return scanner.lookahead[0]
+}
+
+// consumes next token if it is a doc comment (even if Advance would pass
+// over it), e.g. to attach it to the definition which follows
+func (scanner *Scanner) AdvanceDocComment() (Token, bool) {
+	tok := scanner.PeekDocComment()
+
+	if !isDocToken(tok.TType) {
+		return tok, false
+	}
+
+	scanner.lookahead = scanner.lookahead[1:]
+
+	scanner.lastEnd = tok.End()
+
+	return tok, true
+}
+
+// scan token starting at current offset in source, reading more input
+// first if token may continue past what has been read so far
+func (scanner *Scanner) scanNext() Token {
+	for {
+		state := scanner.state()
+
+		tok := scanner.scanToken()
 
-	return scanner.peek2
+		if state.done || !scanner.needsMore(&tok) {
+			return tok
+		}
+
+		scanner.restore(state)
+		scanner.fill()
+	}
 }
 
-func (scanner *Scanner) tokenize(s string) {
+// scan token starting at current offset in src
+func (scanner *Scanner) scanToken() Token {
+	if scanner.done {
+		return scanner.token(TOK_EOF)
+	}
+
+	// cancelled => stop scanning
+	if scanner.ctx.Err() != nil {
+		scanner.done = true
+
+		return scanner.token(TOK_EOF)
+	}
+
+	s := scanner.src
 	sLen := len(s)
 
-	for i := 0; i < sLen; {
-		nbytes := scanner.consumeIgnored(s[i:])
+	start := scanner.offset
 
-		i += nbytes
+	nbytes, failure := scanner.consumeIgnored(s[scanner.offset:])
 
-		ttype, tstr, ok := tryTokFunctions(s[i:])
+	scanner.offset += nbytes
 
-		if ok {
-			tstrLen := len(tstr)
+	leading := s[start:scanner.offset]
 
-			*scanner.tChan <- Token{
-				TType:  ttype,
-				Line:   scanner.line,
-				Column: scanner.column,
-				Width:  tstrLen,
-				Text:   tstr,
-			}
+	if failure != nil {
+		// unterminated comment makes up rest of input
+		rest := s[scanner.offset+len(failure.Text):]
 
-			i += tstrLen
-			scanner.column += utf8.RuneCountInString(tstr)
+		scanner.offset = sLen
+		scanner.done = true
 
-			continue
+		return scanner.withTrivia(*failure, leading, rest)
+	}
+
+	// expression embedded in string must end on its line, else scanning
+	// carries on as if string had ended (with empty failure token there)
+	// so that "}" later on is not taken as rest of string
+	if scanner.interpDepth > 0 && (scanner.offset >= sLen || s[scanner.offset] == '\n') {
+		scanner.interpDepth = 0
+
+		tok := scanner.token(TOK_FAILURE)
+		tok.Reason = REASON_UNTERMINATED_INTERPOLATION
+
+		return scanner.withTrivia(tok, leading, "")
+	}
+
+	// only whitespace/comments remained
+	if scanner.offset >= sLen {
+		scanner.done = true
+
+		return scanner.withTrivia(scanner.token(TOK_EOF), leading, "")
+	}
+
+	var tok Token
+
+	ttype, tstr, ok := tryTokFunctions(s[scanner.offset:])
+
+	// "}" ends expression embedded in string, e.g. "Hello, {name}!"
+	inString := scanner.interpDepth > 0 && s[scanner.offset] == '}'
+
+	if inString {
+		ttype, tstr, ok = scanStringRest(s[scanner.offset:])
+	}
+
+	switch {
+	case !ok:
+	case ttype == TOK_STRING_START:
+		scanner.interpDepth++
+	case inString && ttype != TOK_STRING_MIDDLE:
+		// ended, or unterminated
+		scanner.interpDepth--
+	default:
+	}
+
+	if ok {
+		tstrLen := len(tstr)
+
+		tok = Token{
+			TType:  ttype,
+			Line:   scanner.line,
+			Column: scanner.column,
+			Width:  tstrLen,
+			Text:   tstr,
+			Pos:    scanner.posAt(scanner.offset),
 		}
 
-		ttype, ok = tryTokStrings(s[i:])
+		if ttype == TOK_FAILURE {
+			tok.Reason = failureReason(tstr, inString)
+		}
 
-		if ok {
-			tstrLen := len(TokStrings[ttype])
+		scanner.offset += tstrLen
+		scanner.advancePosition(tstr)
+	} else if ttype, ok = tryTokStrings(s[scanner.offset:]); ok {
+		tstr = TokStrings[ttype]
+		tstrLen := len(tstr)
 
-			*scanner.tChan <- Token{
-				TType:  ttype,
-				Line:   scanner.line,
-				Column: scanner.column,
-				Width:  tstrLen,
-			}
+		tok = Token{
+			TType:  ttype,
+			Line:   scanner.line,
+			Column: scanner.column,
+			Width:  tstrLen,
+			Text:   tstr,
+			Pos:    scanner.posAt(scanner.offset),
+		}
 
-			i += tstrLen
-			scanner.column += utf8.RuneCountInString(tstr)
+		scanner.offset += tstrLen
+		scanner.advancePosition(tstr)
+	} else {
+		// no token begins with character, skip it and carry on
 
-			continue
+		r, bytes := utf8.DecodeRuneInString(s[scanner.offset:])
+
+		tok = scanner.token(TOK_FAILURE)
+		tok.Width = bytes
+		tok.Text = s[scanner.offset : scanner.offset+bytes]
+		tok.Reason = fmt.Sprintf("unexpected character %q", r)
+
+		scanner.offset += bytes
+		scanner.advancePosition(tok.Text)
+	}
+
+	trailing := ""
+
+	if scanner.keepTrivia {
+		trailingStart := scanner.offset
+
+		scanner.offset += scanner.consumeTrailing(s[scanner.offset:])
+
+		trailing = s[trailingStart:scanner.offset]
+	}
+
+	return scanner.withTrivia(tok, leading, trailing)
+}
+
+// attach trivia to token if scanner keeps trivia
+func (scanner *Scanner) withTrivia(tok Token, leading string, trailing string) Token {
+	if scanner.keepTrivia {
+		tok.LeadingTrivia = leading
+		tok.TrailingTrivia = trailing
+	}
+
+	return tok
+}
+
+// keep => comments and whitespace are attached to tokens as trivia,
+// must be set before Tokenize
+func (scanner *Scanner) SetKeepTrivia(keep bool) {
+	scanner.keepTrivia = keep
+}
+
+// skip => Peek, PeekSecond, Advance and Next pass over doc comments,
+// which are then only returned by PeekDocComment and AdvanceDocComment
+// (so a doc comment which documents nothing is ignored)
+func (scanner *Scanner) SetSkipDocComments(skip bool) {
+	scanner.skipDoc = skip
+}
+
+// pipeline goroutine, exit is closed when it returns
+func (scanner *Scanner) tokenize(exit chan struct{}) {
+	defer close(exit)
+
+	for {
+		tok := scanner.scanNext()
+
+		select {
+		case *scanner.tChan <- tok:
+		case <-scanner.ctx.Done():
+			return
 		}
 
-		// failed to parse token
+		if tok.TType == TOK_EOF {
+			break
+		}
+	}
+}
 
-		*scanner.tChan <- scanner.token(TOK_FAILURE)
-		break
+// wait for pipeline goroutine of previous input to exit,
+// discarding any tokens it sends
+func (scanner *Scanner) stopPipeline() {
+	if scanner.pipelineExit == nil {
+		return
 	}
 
-	*scanner.tChan <- scanner.token(TOK_EOF)
+	for {
+		select {
+		case <-*scanner.tChan:
+		case <-scanner.pipelineExit:
+			for len(*scanner.tChan) > 0 {
+				<-*scanner.tChan
+			}
+
+			scanner.pipelineExit = nil
+
+			return
+		}
+	}
 }
 
+// Replace input of scanner with s, scanning restarts from beginning
 func (scanner *Scanner) Tokenize(s string) {
-	if scanner.tChan == nil {
-		scanner.initScanner()
+	scanner.TokenizeContext(context.Background(), s)
+}
+
+// Tokenize, with scanning stopped once ctx is cancelled
+// (TOK_EOF is then returned and Err() returns ctx.Err())
+func (scanner *Scanner) TokenizeContext(ctx context.Context, s string) {
+	scanner.reset(ctx)
+	scanner.addFile()
+
+	scanner.src = s
+	scanner.file.addText(s)
+
+	scanner.start()
+}
+
+// Replace input of scanner with r, which is read incrementally as tokens
+// are scanned (read error ends scanning and is returned by Err())
+func (scanner *Scanner) TokenizeReader(r io.Reader) {
+	scanner.TokenizeReaderContext(context.Background(), r)
+}
+
+func (scanner *Scanner) TokenizeReaderContext(ctx context.Context, r io.Reader) {
+	scanner.reset(ctx)
+	scanner.addFile()
+
+	scanner.reader = r
+
+	scanner.start()
+}
+
+// stop scanning previous input and reset state for new input
+func (scanner *Scanner) reset(ctx context.Context) {
+	scanner.stopPipeline()
+	scanner.closeReader()
+
+	scanner.initScanner()
+
+	scanner.ctx = ctx
+
+	scanner.errMutex.Lock()
+	scanner.err = nil
+	scanner.errMutex.Unlock()
+
+	scanner.filename = ""
+	scanner.src = ""
+	scanner.srcBase = 0
+	scanner.offset = 0
+	scanner.done = false
+	scanner.lastEnd = NoPos
+
+	scanner.reader = nil
+	scanner.readerDone = false
+	scanner.pending = nil
+
+	scanner.lookahead = scanner.lookahead[:0]
+	scanner.pipelineDone = false
+}
+
+// register input in file set, after filename is set. Input with same
+// name as previous (e.g. edited source scanned again) replaces its file so
+// that file set does not grow as scanner is reused.
+func (scanner *Scanner) addFile() {
+	if scanner.fset == nil {
+		scanner.fset = NewFileSet()
+	}
+
+	prev := scanner.file
+
+	if prev != nil && prev.Name() != scanner.filename {
+		prev = nil
 	}
 
-	scanner.isEof = false
+	scanner.file = scanner.fset.replaceFile(prev, scanner.filename)
+}
+
+// Files scanned are registered in fset (so that positions of tokens from
+// several scanners sharing it may be resolved), set before Tokenize.
+// By default each scanner has its own FileSet.
+func (scanner *Scanner) SetFileSet(fset *FileSet) {
+	scanner.fset = fset
+}
 
-	// do tokenization work in separate goroutine
+func (scanner *Scanner) FileSet() *FileSet {
+	return scanner.fset
+}
 
-	go scanner.tokenize(s)
+// file being scanned, nil before Tokenize
+func (scanner *Scanner) File() *SourceFile {
+	return scanner.file
 }
 
-func (scanner *Scanner) TokenizeFile(filepath string) {
-	bytes, err := os.ReadFile(filepath)
+// Pos of byte offset in src
+func (scanner *Scanner) posAt(offset int) Pos {
+	if scanner.file == nil {
+		return NoPos
+	}
+
+	return scanner.file.Pos(scanner.srcBase + offset)
+}
+
+// begin scanning input set after reset
+func (scanner *Scanner) start() {
+	if scanner.tChan != nil {
+		scanner.pipelineExit = make(chan struct{})
+
+		// do tokenization work in separate goroutine
+		go scanner.tokenize(scanner.pipelineExit)
+	}
+}
+
+// error opening or reading source file, wraps underlying error so that
+// e.g. errors.Is(err, fs.ErrNotExist) may be used
+type FileError struct {
+	Filename string
+	Err      error
+}
+
+func (err *FileError) Error() string {
+	return "cannot read " + err.Filename + ": " + err.Err.Error()
+}
+
+func (err *FileError) Unwrap() error {
+	return err.Err
+}
+
+// wrapped by FileError when directory is passed to TokenizeFile
+var ErrIsDirectory = errors.New("is a directory")
+
+func (scanner *Scanner) TokenizeFile(filepath string) error {
+	return scanner.TokenizeFileContext(context.Background(), filepath)
+}
+
+// File is read incrementally, as with TokenizeReader, and closed once
+// scanned or when input is replaced. If it cannot be opened, *FileError
+// is returned (and by Err()) and input is empty.
+func (scanner *Scanner) TokenizeFileContext(ctx context.Context, filepath string) error {
+	scanner.reset(ctx)
+
+	scanner.filename = filepath
+
+	scanner.addFile()
+
+	f, err := openSourceFile(filepath)
 
 	if err != nil {
-		log.Fatalf("TokenizeFile failed to ReadFile: %s\n", err)
-		return
+		scanner.setErr(err)
+	} else {
+		scanner.reader = f
+		scanner.closer = f
+	}
+
+	scanner.start()
+
+	return err
+}
+
+func openSourceFile(filepath string) (*os.File, error) {
+	f, err := os.Open(filepath)
+
+	if err != nil {
+		return nil, &FileError{Filename: filepath, Err: err}
+	}
+
+	info, err := f.Stat()
+
+	if err == nil && info.IsDir() {
+		err = ErrIsDirectory
+	}
+
+	if err != nil {
+		f.Close()
+
+		return nil, &FileError{Filename: filepath, Err: err}
+	}
+
+	return f, nil
+}
+
+// name of file passed to TokenizeFile, empty if Tokenize was used
+func (scanner *Scanner) Filename() string {
+	return scanner.filename
+}
+
+// Returns text of 1-indexed line (without newline), empty if not found.
+// When reading input incrementally, lines well before the token being
+// scanned are discarded and so are not found.
+func (scanner *Scanner) SourceLine(line int) string {
+	scanner.srcMutex.Lock()
+	defer scanner.srcMutex.Unlock()
+
+	if line < scanner.srcLine {
+		return ""
+	}
+
+	rest := scanner.src
+
+	for i := scanner.srcLine; i < line; i++ {
+		newline := strings.IndexByte(rest, '\n')
+
+		if newline == -1 {
+			return ""
+		}
+
+		rest = rest[newline+1:]
+	}
+
+	if newline := strings.IndexByte(rest, '\n'); newline != -1 {
+		rest = rest[:newline]
 	}
 
-	scanner.Tokenize(string(bytes))
+	return strings.TrimSuffix(rest, "\r")
 }
 
-// consume ignored characters (comments, whitespace)
-func (scanner *Scanner) consumeIgnored(s string) int {
+// consume ignored characters (comments, whitespace), returns TOK_FAILURE
+// token at start of block comment if it is not terminated (in which case
+// returned count excludes comment)
+func (scanner *Scanner) consumeIgnored(s string) (int, *Token) {
 	i := 0
 	sLen := len(s)
 
@@ -408,24 +907,39 @@ func (scanner *Scanner) consumeIgnored(s string) int {
 			nextR, nextBytes = utf8.DecodeRuneInString(s[i+bytes:])
 		}
 
+		// doc comment is token rather than ignored
+		if isDocComment(s[i:]) {
+			break
+		}
+
+		// ends expression embedded in string, see scanToken
+		if r == '\n' && scanner.interpDepth > 0 {
+			break
+		}
+
 		// skip past comment
 		if r == '/' && nextR == '/' {
-			scanner.column += 2 // for two forward slashes
-			i += (bytes + nextBytes)
+			i += scanner.consumeLineComment(s[i:])
+
+			continue
+		}
 
-			for i < sLen {
-				r, bytes := utf8.DecodeRuneInString(s[i:])
+		// skip past (possibly nested) block comment
+		if r == '/' && nextR == '*' {
+			start := scanner.token(TOK_FAILURE)
+			start.Pos = scanner.posAt(scanner.offset + i)
+			start.Width = bytes + nextBytes
+			start.Text = s[i : i+start.Width]
+			start.Reason = REASON_UNTERMINATED_COMMENT
 
-				scanner.column++
-				i += bytes
+			nbytes, ok := scanner.consumeBlockComment(s[i:])
 
-				if r == '\n' {
-					scanner.line++
-					scanner.column = 1
-					break
-				}
+			if !ok {
+				return i, &start
 			}
 
+			i += nbytes
+
 			continue
 		}
 
@@ -445,9 +959,163 @@ func (scanner *Scanner) consumeIgnored(s string) int {
 		i += bytes
 	}
 
+	return i, nil
+}
+
+// move line and column past text of token, which may span lines
+// (e.g. multi-line string)
+func (scanner *Scanner) advancePosition(text string) {
+	lastNewline := strings.LastIndexByte(text, '\n')
+
+	if lastNewline < 0 {
+		scanner.column += utf8.RuneCountInString(text)
+		return
+	}
+
+	scanner.line += strings.Count(text, "\n")
+	scanner.column = 1 + utf8.RuneCountInString(text[lastNewline+1:])
+}
+
+// consume line comment which s begins with, including newline
+func (scanner *Scanner) consumeLineComment(s string) int {
+	scanner.column += 2 // for two forward slashes
+
+	i := 2
+	sLen := len(s)
+
+	for i < sLen {
+		r, bytes := utf8.DecodeRuneInString(s[i:])
+
+		// left to end expression embedded in string, see scanToken
+		if r == '\n' && scanner.interpDepth > 0 {
+			break
+		}
+
+		scanner.column++
+		i += bytes
+
+		if r == '\n' {
+			scanner.line++
+			scanner.column = 1
+			break
+		}
+	}
+
 	return i
 }
 
+// consume whitespace and comments after token up to and including end
+// of its line, these make up its trailing trivia
+func (scanner *Scanner) consumeTrailing(s string) int {
+	i := 0
+	sLen := len(s)
+
+	for i < sLen {
+		r, bytes := utf8.DecodeRuneInString(s[i:])
+
+		nextR := ' '
+
+		if i+bytes < sLen {
+			nextR, _ = utf8.DecodeRuneInString(s[i+bytes:])
+		}
+
+		// left to end expression embedded in string, see scanToken
+		if r == '\n' && scanner.interpDepth > 0 {
+			return i
+		}
+
+		if r == '\n' {
+			scanner.line++
+			scanner.column = 1
+
+			return i + bytes
+		}
+
+		if isDocComment(s[i:]) {
+			break
+		}
+
+		if r == '/' && nextR == '/' {
+			return i + scanner.consumeLineComment(s[i:])
+		}
+
+		if r == '/' && nextR == '*' {
+			line, column := scanner.line, scanner.column
+
+			nbytes, ok := scanner.consumeBlockComment(s[i:])
+
+			if !ok {
+				// left to be reported when scanning next token
+				scanner.line, scanner.column = line, column
+
+				return i
+			}
+
+			i += nbytes
+
+			continue
+		}
+
+		if !unicode.IsSpace(r) {
+			break
+		}
+
+		scanner.column++
+		i += bytes
+	}
+
+	return i
+}
+
+// consume block comment which s begins with, false if it is unterminated
+func (scanner *Scanner) consumeBlockComment(s string) (int, bool) {
+	i := 0
+	sLen := len(s)
+
+	depth := 0
+
+	for i < sLen {
+		r, bytes := utf8.DecodeRuneInString(s[i:])
+
+		nextR := ' '
+
+		if i+bytes < sLen {
+			nextR, _ = utf8.DecodeRuneInString(s[i+bytes:])
+		}
+
+		if r == '/' && nextR == '*' {
+			depth++
+			scanner.column += 2
+			i += 2
+
+			continue
+		}
+
+		if r == '*' && nextR == '/' {
+			depth--
+			scanner.column += 2
+			i += 2
+
+			if depth == 0 {
+				return i, true
+			}
+
+			continue
+		}
+
+		if r == '\n' {
+			scanner.line++
+			scanner.column = 1
+		} else {
+			scanner.column++
+		}
+
+		i += bytes
+	}
+
+	return i, false
+}
+
 // see if next token matches fixed-width string tokens
 func tryTokStrings(s string) (TokenType, bool) {
 	matchIdx := -1
@@ -484,6 +1152,8 @@ func tryTokFunctions(s string) (TokenType, string, bool) {
 		scanIdent,
 		scanFloat,
 		scanString,
+		scanDocComment,
+		scanChar,
 	}
 
 	maxMatch := 0
@@ -512,22 +1182,105 @@ func tryTokFunctions(s string) (TokenType, string, bool) {
 	return retTType, retStr, true
 }
 
+func isDecimalDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isHexDigit(r rune) bool {
+	return isDecimalDigit(r) ||
+		(r >= 'a' && r <= 'f') ||
+		(r >= 'A' && r <= 'F')
+}
+
+func isOctalDigit(r rune) bool {
+	return r >= '0' && r <= '7'
+}
+
+func isBinaryDigit(r rune) bool {
+	return r == '0' || r == '1'
+}
+
+// Scans decimal (e.g. 1_000_000) or prefixed (0x, 0o, 0b) integer.
+// Malformed literals (e.g. 0x, 0b102, 1__0) are returned whole
+// as TOK_FAILURE rather than split into several tokens.
 func scanInteger(s string) (TokenType, string, bool) {
-	width := 0
+	sLen := len(s)
 
-	for _, r := range s {
-		if unicode.IsDigit(r) {
-			width += utf8.RuneLen(r)
+	if sLen == 0 || !isDecimalDigit(rune(s[0])) {
+		return TOK_EOF, "", false
+	}
+
+	isDigit := isDecimalDigit
+	prefixLen := 0
+
+	if s[0] == '0' && sLen > 1 {
+		switch s[1] {
+		case 'x', 'X':
+			isDigit = isHexDigit
+			prefixLen = 2
+		case 'o', 'O':
+			isDigit = isOctalDigit
+			prefixLen = 2
+		case 'b', 'B':
+			isDigit = isBinaryDigit
+			prefixLen = 2
+		default:
+		}
+	}
+
+	width := prefixLen
+
+	// literal takes any following letters or digits so that
+	// e.g. 0b102 or 123abc is reported whole
+	for width < sLen {
+		r, bytes := utf8.DecodeRuneInString(s[width:])
+
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			width += bytes
 		} else {
 			break
 		}
 	}
 
-	if width == 0 {
-		return TOK_EOF, "", false
+	text := s[:width]
+
+	if !validIntegerDigits(text[prefixLen:], isDigit, prefixLen > 0) {
+		return TOK_FAILURE, text, true
 	}
 
-	return TOK_INTEGER, s[:width], true
+	return TOK_INTEGER, text, true
+}
+
+// digits must be non-empty with underscores only between digits
+// (or, if prefixed, between prefix and first digit)
+func validIntegerDigits(
+	digits string,
+	isDigit func(rune) bool,
+	prefixed bool,
+) bool {
+	foundDigit := false
+	prevUnderscore := false
+
+	for i, r := range digits {
+		if r == '_' {
+			if prevUnderscore || (i == 0 && !prefixed) {
+				return false
+			}
+
+			prevUnderscore = true
+
+			continue
+		}
+
+		if !isDigit(r) {
+			return false
+		}
+
+		foundDigit = true
+		prevUnderscore = false
+	}
+
+	return foundDigit && !prevUnderscore
 }
 
 func scanIdent(s string) (TokenType, string, bool) {
@@ -570,16 +1323,26 @@ func scanFloat(s string) (TokenType, string, bool) {
 	eEndOffset := -1
 	digitsAfterE := false
 
+	// digit separators are not allowed, but are taken so that e.g.
+	// 1_000.5 is reported whole
+	separated := false
+	prevDigit := false
+
 	totalWidth := 0
 	sLen := len(s)
 
 	for totalWidth < sLen {
 		r, width := utf8.DecodeRuneInString(s[totalWidth:])
 
-		if unicode.IsDigit(r) {
+		isDigit := unicode.IsDigit(r)
+
+		if isDigit {
 			if eOffset != -1 {
 				digitsAfterE = true
 			}
+		} else if r == '_' && prevDigit {
+			separated = true
+			isDigit = true
 		} else if r == '.' {
 			if pointOffset != -1 {
 				break
@@ -601,6 +1364,7 @@ func scanFloat(s string) (TokenType, string, bool) {
 			break
 		}
 
+		prevDigit = isDigit
 		totalWidth += width
 	}
 
@@ -615,42 +1379,221 @@ func scanFloat(s string) (TokenType, string, bool) {
 		return TOK_EOF, "", false
 	}
 
+	if separated {
+		return TOK_FAILURE, s[:totalWidth], true
+	}
+
 	// success, return relevant slice
 
 	return TOK_FLOAT, s[:totalWidth], true
 }
 
+// reason for TOK_FAILURE found by scan function, e.g. for 0x or "abc
+// (inString => found after expression embedded in string)
+func failureReason(text string, inString bool) string {
+	switch {
+	case inString || strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "`"):
+		return REASON_UNTERMINATED_STRING
+	case strings.HasPrefix(text, "'"):
+		return REASON_UNTERMINATED_CHAR
+	case strings.Contains(text, "."):
+		return REASON_MALFORMED_FLOAT
+	default:
+		return REASON_MALFORMED_INTEGER
+	}
+}
+
+// true => tok is TOK_FAILURE which more input could complete,
+// e.g. string whose closing quote is yet to be read
+func isUnterminated(tok *Token) bool {
+	if tok.TType != TOK_FAILURE {
+		return false
+	}
+
+	switch tok.Reason {
+	case REASON_UNTERMINATED_STRING,
+		REASON_UNTERMINATED_CHAR,
+		REASON_UNTERMINATED_INTERPOLATION,
+		REASON_UNTERMINATED_COMMENT:
+		return true
+	default:
+	}
+
+	return false
+}
+
+// s up to end of its first line, e.g. text of unterminated string which
+// is skipped so that scanning may resume on next line
+func restOfLine(s string) string {
+	if newline := strings.IndexByte(s, '\n'); newline != -1 {
+		s = s[:newline]
+	}
+
+	return strings.TrimSuffix(s, "\r")
+}
+
+// e.g. "a\tb", """ multi-line """ or `raw`, or start of interpolated
+// string up to its first embedded expression, e.g. "Hello, {
+// (unterminated string gives TOK_FAILURE up to end of line)
 func scanString(s string) (TokenType, string, bool) {
-	foundEndQuote := false
+	if strings.HasPrefix(s, TRIPLE_QUOTE) {
+		return scanTripleQuotedString(s)
+	}
 
-	width := 0
+	if strings.HasPrefix(s, "`") {
+		return scanRawString(s)
+	}
+
+	if !strings.HasPrefix(s, `"`) {
+		return TOK_EOF, "", false
+	}
+
+	width, delim, ok := scanQuoted(s)
+
+	if !ok {
+		return TOK_FAILURE, restOfLine(s), true
+	}
+
+	if delim == '{' {
+		return TOK_STRING_START, s[:width], true
+	}
+
+	return TOK_STRING, s[:width], true
+}
+
+// Rest of interpolated string after embedded expression, up to next
+// expression or closing quote, e.g. }, { or }!"
+// (unterminated string gives TOK_FAILURE from "}" up to end of line)
+func scanStringRest(s string) (TokenType, string, bool) {
+	width, delim, ok := scanQuoted(s)
+
+	if !ok {
+		return TOK_FAILURE, restOfLine(s), true
+	}
+
+	if delim == '{' {
+		return TOK_STRING_MIDDLE, s[:width], true
+	}
+
+	return TOK_STRING_END, s[:width], true
+}
+
+// Scan double-quoted string after its first character until closing quote
+// or "{" beginning embedded expression, returns width including that
+// delimiter and which one it was. Escaped characters (e.g. \" or \{)
+// are skipped, as are braces of \u{...} escapes.
+func scanQuoted(s string) (int, byte, bool) {
 	sLen := len(s)
 
-	isEscaped := false
+	for i := 1; i < sLen; i++ {
+		switch s[i] {
+		case '\\':
+			if strings.HasPrefix(s[i:], "\\u{") {
+				if end := strings.IndexAny(s[i:], "}\""); end >= 0 && s[i+end] == '}' {
+					i += end
+					continue
+				}
+			}
+
+			i++
+		case '"', '{':
+			return i + 1, s[i], true
+		default:
+		}
+	}
 
-	for width < sLen {
-		r, bytes := utf8.DecodeRuneInString(s[width:])
+	return 0, 0, false
+}
 
-		if width == 0 && r != '"' {
-			break
+// e.g. 'a', '\n' or '\u{1F600}', which may not span lines
+// (validated as single code point by parser, unterminated literal gives
+// TOK_FAILURE up to end of line)
+func scanChar(s string) (TokenType, string, bool) {
+	if !strings.HasPrefix(s, "'") {
+		return TOK_EOF, "", false
+	}
+
+	line := restOfLine(s)
+	lineLen := len(line)
+
+	for i := 1; i < lineLen; i++ {
+		switch line[i] {
+		case '\\':
+			i++
+		case '\'':
+			return TOK_CHAR, line[:i+1], true
+		default:
 		}
+	}
 
-		if isEscaped {
-			isEscaped = false
-		} else if width != 0 && r == '"' {
-			foundEndQuote = true
-			width += bytes
-			break
-		} else if r == '\\' {
-			isEscaped = true
+	return TOK_FAILURE, line, true
+}
+
+// string delimited by triple quotes, which may span lines
+// (unterminated string gives TOK_FAILURE up to end of line)
+func scanTripleQuotedString(s string) (TokenType, string, bool) {
+	width := len(TRIPLE_QUOTE)
+	sLen := len(s)
+
+	for width < sLen {
+		if s[width] == '\\' {
+			width += 2
+			continue
+		}
+
+		if strings.HasPrefix(s[width:], TRIPLE_QUOTE) {
+			return TOK_STRING, s[:width+len(TRIPLE_QUOTE)], true
 		}
 
-		width += bytes
+		width++
+	}
+
+	return TOK_FAILURE, restOfLine(s), true
+}
+
+// e.g. `\d+\.\d+`, has no escapes so may not contain backtick
+// (unterminated string gives TOK_FAILURE up to end of line)
+func scanRawString(s string) (TokenType, string, bool) {
+	end := strings.IndexByte(s[1:], '`')
+
+	if end < 0 {
+		return TOK_FAILURE, restOfLine(s), true
+	}
+
+	return TOK_STRING, s[:end+2], true
+}
+
+// e.g. /// doc or //! file doc, but not //// which is ordinary comment
+func isDocComment(s string) bool {
+	if strings.HasPrefix(s, "//!") {
+		return true
 	}
 
-	if width == 0 || !foundEndQuote {
+	return strings.HasPrefix(s, "///") && !strings.HasPrefix(s, "////")
+}
+
+// e.g. TOK_DOC_COMMENT for /// doc
+func isDocToken(ttype TokenType) bool {
+	return ttype == TOK_DOC_COMMENT || ttype == TOK_FILE_DOC_COMMENT
+}
+
+// doc comment up to (not including) end of line
+func scanDocComment(s string) (TokenType, string, bool) {
+	if !isDocComment(s) {
 		return TOK_EOF, "", false
 	}
 
-	return TOK_STRING, s[:width], true
+	ttype := TOK_DOC_COMMENT
+
+	if strings.HasPrefix(s, "//!") {
+		ttype = TOK_FILE_DOC_COMMENT
+	}
+
+	width := strings.IndexByte(s, '\n')
+
+	if width < 0 {
+		width = len(s)
+	}
+
+	return ttype, strings.TrimSuffix(s[:width], "\r"), true
 }
@@ -1,6 +1,17 @@
 package scanner
 
-import "testing"
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf8"
+)
 
 func TestScannerTokenType(t *testing.T) {
 	testMap := map[string][]TokenType{
@@ -26,6 +37,7 @@ func TestScannerTokenType(t *testing.T) {
 			TOK_SEMI,
 		},
 		`1.5 "Hello, World!" while`: {TOK_FLOAT, TOK_STRING, TOK_WHILE},
+		`'a' '\'' '\u{1F600}' x`:    {TOK_CHAR, TOK_CHAR, TOK_CHAR, TOK_IDENT},
 	}
 
 	tokStringsLen := len(TokStrings)
@@ -82,6 +94,11 @@ func TestScanFloat(t *testing.T) {
 		".E5",
 		"1.5E",
 	}
+	malformedFloats := [...]string{
+		"1_000.5",
+		"1.5_0",
+		"1_0.5E+1_0",
+	}
 
 	for _, s := range validFloats {
 		_, foundS, found := scanFloat(s)
@@ -97,6 +114,13 @@ func TestScanFloat(t *testing.T) {
 			)
 		}
 	}
+	for _, s := range malformedFloats {
+		ttype, foundS, found := scanFloat(s)
+
+		if !found || ttype != TOK_FAILURE || s != foundS {
+			t.Errorf("Expected failure token for \"%s\", got \"%s\"", s, foundS)
+		}
+	}
 	for _, s := range invalidFloats {
 		_, _, found := scanFloat(s)
 
@@ -106,11 +130,46 @@ func TestScanFloat(t *testing.T) {
 	}
 }
 
+func TestTrailingWhitespace(t *testing.T) {
+	testStrs := []string{
+		"x ",
+		"x \n\t ",
+		"x // comment",
+	}
+
+	expected := []TokenType{TOK_IDENT, TOK_EOF}
+
+	for _, s := range testStrs {
+		scan := NewScanner()
+
+		scan.Tokenize(s)
+
+		for idx, ttype := range expected {
+			tok := scan.Advance()
+
+			if tok.TType != ttype {
+				t.Errorf(
+					"For string %q at index %d expected %s but got %s",
+					s,
+					idx,
+					ttype.Desc(),
+					tok.TType.Desc(),
+				)
+			}
+		}
+	}
+}
+
 func TestScanString(t *testing.T) {
 	validStrings := [...]string{
 		`"Hello"`,
 		"\"Hello\\\"\\\"\\\"\\\\\"",
 		"\"Hello, World!!!!\n\n\t\r\"",
+		"`C:\\path\\\"x\"`",
+		"`multi\nline`",
+		`""""""`,
+		"\"\"\"\n  SELECT \"x\"\n  FROM t\n  \"\"\"",
+		`"""escaped \""" quotes"""`,
 	}
 	invalidStrings := [...]string{
 		`"Hello`,
@@ -135,11 +194,1093 @@ func TestScanString(t *testing.T) {
 			)
 		}
 	}
+	// unterminated strings are found as failures
 	for _, s := range invalidStrings {
-		_, _, found := scanString(s)
+		ttype, _, found := scanString(s)
 
-		if found {
+		if found && ttype != TOK_FAILURE {
 			t.Errorf("Expected not to find string literal in \"%s\"", s)
 		}
 	}
 }
+
+func TestNextMatchesPipeline(t *testing.T) {
+	s := `
+	function f(x : Integer) : Integer
+	begin
+		return x ** 2 + 1.5;
+	end;
+	`
+
+	scan := NewScanner()
+	pipeline := NewPipelineScanner()
+
+	scan.Tokenize(s)
+	pipeline.Tokenize(s)
+
+	for {
+		tok := scan.Next()
+		pipelineTok := pipeline.Advance()
+
+		if tok != pipelineTok {
+			t.Errorf("Expected %v from pipeline, got %v", tok, pipelineTok)
+		}
+
+		if tok.TType == TOK_EOF || pipelineTok.TType == TOK_EOF {
+			break
+		}
+	}
+
+	// further calls keep returning TOK_EOF
+	if tok := scan.Next(); tok.TType != TOK_EOF {
+		t.Errorf("Expected EOF, got %v", tok)
+	}
+	if tok := pipeline.Next(); tok.TType != TOK_EOF {
+		t.Errorf("Expected EOF, got %v", tok)
+	}
+}
+
+func TestNextAfterPeek(t *testing.T) {
+	scan := NewScanner()
+
+	scan.Tokenize("x := 5;")
+
+	if tok := scan.PeekSecond(); tok.TType != TOK_COLON_EQ {
+		t.Errorf("Expected := from PeekSecond, got %v", tok)
+	}
+
+	expected := [...]TokenType{TOK_IDENT, TOK_COLON_EQ, TOK_INTEGER, TOK_SEMI, TOK_EOF}
+
+	for idx, ttype := range expected {
+		if tok := scan.Next(); tok.TType != ttype {
+			t.Errorf("At index %d expected %s, got %s", idx, ttype.Desc(), tok.TType.Desc())
+		}
+	}
+
+	// scanning restarts with new input
+	scan.Tokenize("if")
+
+	if tok := scan.Next(); tok.TType != TOK_IF || tok.Line != 1 {
+		t.Errorf("Expected if on line 1, got %v", tok)
+	}
+}
+
+func TestCancelledScanner(t *testing.T) {
+	for _, scan := range [...]*Scanner{NewScanner(), NewPipelineScanner()} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		scan.TokenizeContext(ctx, strings.Repeat("x := 5;\n", 1000))
+
+		if tok := scan.Advance(); tok.TType != TOK_IDENT {
+			t.Errorf("Expected identifier before cancel, got %v", tok)
+		}
+
+		cancel()
+
+		// tokens already scanned by pipeline may still be returned
+		for i := 0; scan.Advance().TType != TOK_EOF; i++ {
+			if i > 4000 {
+				t.Fatalf("Expected EOF after cancel")
+			}
+		}
+
+		if !errors.Is(scan.Err(), context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", scan.Err())
+		}
+
+		// pipeline goroutine has exited, scanner may be reused
+		scan.Tokenize("if")
+
+		if tok := scan.Advance(); tok.TType != TOK_IF {
+			t.Errorf("Expected if after reuse, got %v", tok)
+		}
+		if scan.Err() != nil {
+			t.Errorf("Expected no error after reuse, got %v", scan.Err())
+		}
+	}
+}
+
+// returns chunk on first read, then cancels and blocks until ctx is done
+type cancellingReader struct {
+	chunk  string
+	ctx    context.Context
+	cancel context.CancelFunc
+	read   bool
+}
+
+func (r *cancellingReader) Read(p []byte) (int, error) {
+	if !r.read {
+		r.read = true
+
+		return copy(p, r.chunk), nil
+	}
+
+	r.cancel()
+
+	<-r.ctx.Done()
+
+	return 0, r.ctx.Err()
+}
+
+// reader fails in pipeline goroutine as consumer sees cancellation
+// (run with -race)
+func TestCancelledReaderPipeline(t *testing.T) {
+	for _, scan := range [...]*Scanner{NewScanner(), NewPipelineScanner()} {
+		ctx, cancel := context.WithCancel(context.Background())
+
+		scan.TokenizeReaderContext(ctx, &cancellingReader{
+			chunk:  strings.Repeat("x := 5;\n", 100),
+			ctx:    ctx,
+			cancel: cancel,
+		})
+
+		for i := 0; scan.Advance().TType != TOK_EOF; i++ {
+			if i > 1000 {
+				t.Fatalf("Expected EOF after cancel")
+			}
+		}
+
+		if !errors.Is(scan.Err(), context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", scan.Err())
+		}
+
+		scan.Tokenize("if")
+
+		if tok := scan.Advance(); tok.TType != TOK_IF || scan.Err() != nil {
+			t.Errorf("Expected if without error after reuse, got %v (%v)", tok, scan.Err())
+		}
+	}
+}
+
+func TestScanInteger(t *testing.T) {
+	validInts := [...]string{
+		"0",
+		"5",
+		"1_000_000",
+		"0xFF",
+		"0Xdead_BEEF",
+		"0x_FF",
+		"0o755",
+		"0b1010_0101",
+	}
+	malformedInts := [...]string{
+		"0x",
+		"0b102",
+		"0o8",
+		"0xFG",
+		"1__0",
+		"1_000_",
+		"0b_",
+		"123abc",
+		"5x",
+		"1e5",
+		"1_0é",
+	}
+	invalidInts := [...]string{
+		"",
+		"x",
+		"_1",
+		".5",
+	}
+
+	for _, s := range validInts {
+		ttype, foundS, found := scanInteger(s)
+
+		if !found || ttype != TOK_INTEGER {
+			t.Errorf("Expected to find integer in \"%s\"", s)
+		}
+		if s != foundS {
+			t.Errorf("Expected to receive \"%s\", got \"%s\"", s, foundS)
+		}
+	}
+	for _, s := range malformedInts {
+		ttype, foundS, found := scanInteger(s)
+
+		if !found || ttype != TOK_FAILURE {
+			t.Errorf("Expected failure token for \"%s\"", s)
+		}
+		if s != foundS {
+			t.Errorf("Expected to receive \"%s\", got \"%s\"", s, foundS)
+		}
+	}
+	for _, s := range invalidInts {
+		_, _, found := scanInteger(s)
+
+		if found {
+			t.Errorf("Expected not to find integer in \"%s\"", s)
+		}
+	}
+}
+
+func TestBlockComments(t *testing.T) {
+	testMap := map[string][]Token{
+		"/* comment */ 5": {
+			{TType: TOK_INTEGER, Line: 1, Column: 15},
+		},
+		"/* a\n b /* c */ d\n */ x\ny": {
+			{TType: TOK_IDENT, Line: 3, Column: 5},
+			{TType: TOK_IDENT, Line: 4, Column: 1},
+		},
+		"/* /* nested */ */ x // line\n/**/z": {
+			{TType: TOK_IDENT, Line: 1, Column: 20},
+			{TType: TOK_IDENT, Line: 2, Column: 5},
+		},
+		"x /* a /* b */\ny": {
+			{TType: TOK_IDENT, Line: 1, Column: 1},
+			{TType: TOK_FAILURE, Line: 1, Column: 3, Text: "/*"},
+			{TType: TOK_EOF},
+		},
+	}
+
+	for s, toks := range testMap {
+		scan := NewScanner()
+
+		scan.Tokenize(s)
+
+		for idx, expected := range toks {
+			tok := scan.Advance()
+
+			if tok.TType != expected.TType ||
+				(expected.Line != 0 && (tok.Line != expected.Line || tok.Column != expected.Column)) ||
+				(expected.Text != "" && tok.Text != expected.Text) {
+				t.Errorf(
+					"For string %q at index %d expected %v but got %v",
+					s,
+					idx,
+					expected,
+					tok,
+				)
+			}
+		}
+	}
+}
+
+func TestTriviaRoundTrip(t *testing.T) {
+	testStrs := []string{
+		"",
+		"  \n\t ",
+		"x := 5; // five\n",
+		"// header\n\nfunction f() : Integer\n  return 1 + 2; /* sum */\n",
+		"/* /* nested */ */ a.b(c, d)  \r\n  // trailing",
+		"x /* a */ /* b\n */ y\n\n",
+		"x /* a /* b */\ny",
+		"a $ b c",
+		"s := \"a {x // c\n} y",
+	}
+
+	for _, s := range testStrs {
+		scan := NewScanner()
+
+		scan.SetKeepTrivia(true)
+		scan.Tokenize(s)
+
+		var sb strings.Builder
+
+		for {
+			tok := scan.Advance()
+
+			sb.WriteString(tok.LeadingTrivia)
+			sb.WriteString(tok.Text)
+			sb.WriteString(tok.TrailingTrivia)
+
+			if tok.TType == TOK_EOF {
+				break
+			}
+		}
+
+		if sb.String() != s {
+			t.Errorf("For string %q round trip gave %q", s, sb.String())
+		}
+	}
+}
+
+func TestTrivia(t *testing.T) {
+	scan := NewScanner()
+
+	scan.SetKeepTrivia(true)
+	scan.Tokenize("// a\nx; // b\n  y\n")
+
+	expected := []Token{
+		{TType: TOK_IDENT, Line: 2, Column: 1, Width: 1, Text: "x",
+			Pos: MakePos(1, 5), LeadingTrivia: "// a\n"},
+		{TType: TOK_SEMI, Line: 2, Column: 2, Width: 1, Text: ";",
+			Pos: MakePos(1, 6), TrailingTrivia: " // b\n"},
+		{TType: TOK_IDENT, Line: 3, Column: 3, Width: 1, Text: "y",
+			Pos: MakePos(1, 15), LeadingTrivia: "  ", TrailingTrivia: "\n"},
+		{TType: TOK_EOF, Line: 4, Column: 1, Pos: MakePos(1, 17)},
+	}
+
+	for idx, exp := range expected {
+		tok := scan.Advance()
+
+		if tok != exp {
+			t.Errorf("At index %d expected %v but got %v", idx, exp, tok)
+		}
+	}
+}
+
+func TestScanDocComments(t *testing.T) {
+	testMap := map[string][]Token{
+		"/// doc\nx": {
+			{TType: TOK_DOC_COMMENT, Line: 1, Column: 1, Text: "/// doc"},
+			{TType: TOK_IDENT, Line: 2, Column: 1, Text: "x"},
+		},
+		"//! file\r\n// plain\n//// plain\nx": {
+			{TType: TOK_FILE_DOC_COMMENT, Line: 1, Column: 1, Text: "//! file"},
+			{TType: TOK_IDENT, Line: 4, Column: 1, Text: "x"},
+		},
+		"x; /// trailing": {
+			{TType: TOK_IDENT, Line: 1, Column: 1, Text: "x"},
+			{TType: TOK_SEMI},
+			{TType: TOK_DOC_COMMENT, Text: "/// trailing"},
+			{TType: TOK_EOF},
+		},
+	}
+
+	for s, toks := range testMap {
+		scan := NewScanner()
+
+		scan.Tokenize(s)
+
+		for idx, expected := range toks {
+			tok := scan.Advance()
+
+			if tok.TType != expected.TType ||
+				(expected.Line != 0 && (tok.Line != expected.Line || tok.Column != expected.Column)) ||
+				(expected.Text != "" && tok.Text != expected.Text) {
+				t.Errorf(
+					"For string %q at index %d expected %v but got %v",
+					s,
+					idx,
+					expected,
+					tok,
+				)
+			}
+		}
+	}
+}
+
+func TestSkipDocComments(t *testing.T) {
+	scan := NewScanner()
+
+	scan.SetSkipDocComments(true)
+	scan.Tokenize("/// a\nx /// b\n//! c\ny")
+
+	if tok := scan.PeekDocComment(); tok.TType != TOK_DOC_COMMENT {
+		t.Errorf("Expected doc comment but got %v", tok)
+	}
+
+	if tok := scan.PeekSecond(); tok.TType != TOK_IDENT || tok.Text != "y" {
+		t.Errorf("Expected y after x but got %v", tok)
+	}
+
+	if tok, ok := scan.AdvanceDocComment(); !ok || tok.Text != "/// a" {
+		t.Errorf("Expected /// a but got %v", tok)
+	}
+
+	if _, ok := scan.AdvanceDocComment(); ok {
+		t.Errorf("Expected no doc comment before x")
+	}
+
+	expected := []string{"x", "y", ""}
+
+	for idx, text := range expected {
+		tok := scan.Advance()
+
+		if tok.Text != text || isDocToken(tok.TType) {
+			t.Errorf("At index %d expected %q but got %v", idx, text, tok)
+		}
+	}
+}
+
+func TestScanStringPositions(t *testing.T) {
+	testMap := map[string][]Token{
+		"\"a\nb\" x": {
+			{TType: TOK_STRING, Line: 1, Column: 1},
+			{TType: TOK_IDENT, Line: 2, Column: 4},
+		},
+		"`a\n\nbc` x\ny": {
+			{TType: TOK_STRING, Line: 1, Column: 1},
+			{TType: TOK_IDENT, Line: 3, Column: 5},
+			{TType: TOK_IDENT, Line: 4, Column: 1},
+		},
+		"\"\"\"\n  é\n  \"\"\" x": {
+			{TType: TOK_STRING, Line: 1, Column: 1},
+			{TType: TOK_IDENT, Line: 3, Column: 7},
+		},
+		"x \"\"\" abc": {
+			{TType: TOK_IDENT, Line: 1, Column: 1},
+			{TType: TOK_FAILURE, Line: 1, Column: 3, Text: `""" abc`},
+		},
+		"x `abc": {
+			{TType: TOK_IDENT, Line: 1, Column: 1},
+			{TType: TOK_FAILURE, Line: 1, Column: 3, Text: "`abc"},
+		},
+	}
+
+	for s, toks := range testMap {
+		scan := NewScanner()
+
+		scan.Tokenize(s)
+
+		for idx, expected := range toks {
+			tok := scan.Advance()
+
+			if tok.TType != expected.TType ||
+				tok.Line != expected.Line || tok.Column != expected.Column ||
+				(expected.Text != "" && tok.Text != expected.Text) {
+				t.Errorf(
+					"For string %q at index %d expected %v but got %v",
+					s,
+					idx,
+					expected,
+					tok,
+				)
+			}
+		}
+	}
+}
+
+func TestScanInterpolatedStrings(t *testing.T) {
+	testMap := map[string][]TokenType{
+		`"Hello, {name}!"`: {TOK_STRING_START, TOK_IDENT, TOK_STRING_END},
+		`"{a} and {b}"`: {
+			TOK_STRING_START,
+			TOK_IDENT,
+			TOK_STRING_MIDDLE,
+			TOK_IDENT,
+			TOK_STRING_END,
+		},
+		`"a {f("b {x}")} c" y`: {
+			TOK_STRING_START,
+			TOK_IDENT,
+			TOK_L_PAREN,
+			TOK_STRING_START,
+			TOK_IDENT,
+			TOK_STRING_END,
+			TOK_R_PAREN,
+			TOK_STRING_END,
+			TOK_IDENT,
+		},
+		`"\{x\}" y`:  {TOK_STRING, TOK_IDENT},
+		"`{x}` y":    {TOK_STRING, TOK_IDENT},
+		`"\u{41}" y`: {TOK_STRING, TOK_IDENT},
+		`"a {x} b`:   {TOK_STRING_START, TOK_IDENT, TOK_FAILURE, TOK_EOF},
+		`x } y`:      {TOK_IDENT, TOK_FAILURE, TOK_IDENT, TOK_EOF},
+	}
+
+	for s, ttypeList := range testMap {
+		scan := NewScanner()
+
+		scan.Tokenize(s)
+
+		for idx, expected := range append(ttypeList, TOK_EOF) {
+			tok := scan.Advance()
+
+			if tok.TType != expected {
+				t.Errorf(
+					"For string %s at index %d expected %s but got %s",
+					s,
+					idx,
+					expected.Desc(),
+					tok.TType.Desc(),
+				)
+				break
+			}
+		}
+	}
+}
+
+// expression embedded in string ends with its line, so later "}" is not
+// taken as rest of string (even once scanner is reused)
+func TestUnterminatedInterpolation(t *testing.T) {
+	testMap := map[string][]Token{
+		"\"a {x\n} y": {
+			{TType: TOK_STRING_START},
+			{TType: TOK_IDENT, Text: "x"},
+			{TType: TOK_FAILURE, Line: 1, Column: 6, Reason: REASON_UNTERMINATED_INTERPOLATION},
+			{TType: TOK_FAILURE, Line: 2, Column: 1, Text: "}"},
+			{TType: TOK_IDENT, Text: "y"},
+		},
+		"\"a {x // c\n}\"": {
+			{TType: TOK_STRING_START},
+			{TType: TOK_IDENT, Text: "x"},
+			{TType: TOK_FAILURE, Line: 1, Column: 11, Reason: REASON_UNTERMINATED_INTERPOLATION},
+			{TType: TOK_FAILURE, Line: 2, Column: 1, Text: "}"},
+			{TType: TOK_FAILURE, Reason: REASON_UNTERMINATED_STRING},
+		},
+		"\"a {x": {
+			{TType: TOK_STRING_START},
+			{TType: TOK_IDENT, Text: "x"},
+			{TType: TOK_FAILURE, Reason: REASON_UNTERMINATED_INTERPOLATION},
+		},
+	}
+
+	for s, toks := range testMap {
+		for _, keepTrivia := range [...]bool{false, true} {
+			scan := NewScanner()
+
+			scan.SetKeepTrivia(keepTrivia)
+			scan.Tokenize(s)
+
+			for idx, expected := range append(toks, Token{TType: TOK_EOF}) {
+				tok := scan.Advance()
+
+				if tok.TType != expected.TType ||
+					(expected.Line != 0 && (tok.Line != expected.Line || tok.Column != expected.Column)) ||
+					(expected.Text != "" && tok.Text != expected.Text) ||
+					(expected.Reason != "" && tok.Reason != expected.Reason) {
+					t.Errorf(
+						"For string %q at index %d expected %v but got %v",
+						s,
+						idx,
+						expected,
+						tok,
+					)
+				}
+			}
+
+			// "}" of new input is not rest of string
+			scan.Tokenize("} y")
+
+			if tok := scan.Advance(); tok.TType != TOK_FAILURE || tok.Text != "}" {
+				t.Errorf("For string %q expected } after reuse but got %v", s, tok)
+			}
+		}
+	}
+}
+
+// all tokens of scanner up to and including TOK_EOF
+func scanAll(scan *Scanner) []Token {
+	var toks []Token
+
+	for {
+		tok := scan.Advance()
+
+		toks = append(toks, tok)
+
+		if tok.TType == TOK_EOF {
+			return toks
+		}
+	}
+}
+
+func TestTokenizeReader(t *testing.T) {
+	long := strings.Repeat("x_é := 1.5e3 ** y; // commentaire ünïcode\n", 5000)
+
+	testStrs := []string{
+		"",
+		"héllo wörld 1.25 ** 2 **= 3",
+		"/* a /* b */ c */ \"str\\\"ing\" `raw\nstring` '😀'",
+		"\"\"\"\n  multi\n  line\n  \"\"\" \"a {b} c\" x",
+		"1.5e+10 0x_FF 1__0",
+		"x /* unterminated",
+		"x $ y",
+		long,
+		long + "\"unterminated",
+		"a @ b 'c\nd \"e {f} g\nh `i\n" + long,
+	}
+
+	readers := map[string]func(string) io.Reader{
+		"one byte": func(s string) io.Reader {
+			return iotest.OneByteReader(strings.NewReader(s))
+		},
+		"half": func(s string) io.Reader {
+			return iotest.HalfReader(strings.NewReader(s))
+		},
+		"whole": func(s string) io.Reader {
+			return strings.NewReader(s)
+		},
+	}
+
+	for _, s := range testStrs {
+		expected := NewScanner()
+
+		expected.SetKeepTrivia(true)
+		expected.Tokenize(s)
+
+		expectedToks := scanAll(expected)
+
+		for name, newReader := range readers {
+			if name == "one byte" && len(s) > 1000 {
+				continue
+			}
+
+			for _, pipeline := range []bool{false, true} {
+				scan := NewScanner()
+
+				if pipeline {
+					scan = NewPipelineScanner()
+				}
+
+				scan.SetKeepTrivia(true)
+				scan.TokenizeReader(newReader(s))
+
+				toks := scanAll(scan)
+
+				if len(toks) != len(expectedToks) {
+					t.Errorf(
+						"For %s reader of %.20q expected %d tokens, got %d",
+						name,
+						s,
+						len(expectedToks),
+						len(toks),
+					)
+					continue
+				}
+
+				for i := range toks {
+					if toks[i] != expectedToks[i] {
+						t.Errorf(
+							"For %s reader of %.20q at index %d expected %v but got %v",
+							name,
+							s,
+							i,
+							expectedToks[i],
+							toks[i],
+						)
+						break
+					}
+				}
+
+				if scan.Err() != nil {
+					t.Errorf("Unexpected error %s", scan.Err())
+				}
+			}
+		}
+	}
+}
+
+func TestTokenizeReaderSourceLine(t *testing.T) {
+	src := strings.Repeat("line;\n", 50000) + "last"
+
+	scan := NewScanner()
+
+	scan.TokenizeReader(strings.NewReader(src))
+
+	for {
+		tok := scan.Advance()
+
+		if tok.TType == TOK_IDENT && tok.Text == "last" {
+			if scan.SourceLine(tok.Line) != "last" || tok.Line != 50001 {
+				t.Errorf("Unexpected line %d: %q", tok.Line, scan.SourceLine(tok.Line))
+			}
+
+			break
+		}
+	}
+
+	// early lines were discarded as they were scanned
+	if scan.SourceLine(1) != "" {
+		t.Errorf("Expected first line to be discarded")
+	}
+}
+
+func TestTokenizeReaderError(t *testing.T) {
+	readErr := errors.New("read failed")
+
+	scan := NewScanner()
+
+	scan.TokenizeReader(io.MultiReader(
+		strings.NewReader("x y"),
+		iotest.ErrReader(readErr),
+	))
+
+	toks := scanAll(scan)
+
+	if len(toks) != 3 || toks[1].Text != "y" {
+		t.Errorf("Expected tokens x, y, EOF but got %v", toks)
+	}
+
+	if !errors.Is(scan.Err(), readErr) {
+		t.Errorf("Expected read error, got %v", scan.Err())
+	}
+}
+
+func TestTokenizeFileErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	unreadable := filepath.Join(dir, "unreadable.pgs")
+
+	if err := os.WriteFile(unreadable, []byte("x"), 0o000); err != nil {
+		t.Fatal(err)
+	}
+
+	testMap := map[string]error{
+		filepath.Join(dir, "missing.pgs"): fs.ErrNotExist,
+		dir:                               ErrIsDirectory,
+		unreadable:                        fs.ErrPermission,
+	}
+
+	for path, expected := range testMap {
+		if expected == fs.ErrPermission {
+			if _, err := os.ReadFile(path); err == nil {
+				// e.g. running as root
+				t.Log("Skipping permission check, file is readable")
+				continue
+			}
+		}
+
+		for _, pipeline := range []bool{false, true} {
+			scan := NewScanner()
+
+			if pipeline {
+				scan = NewPipelineScanner()
+			}
+
+			err := scan.TokenizeFile(path)
+
+			var fileErr *FileError
+
+			if !errors.As(err, &fileErr) || fileErr.Filename != path {
+				t.Errorf("For %s expected *FileError, got %v", path, err)
+			}
+
+			if !errors.Is(err, expected) {
+				t.Errorf("For %s expected error wrapping %v, got %v", path, expected, err)
+			}
+
+			// scanner is left with empty input and reports error
+			if tok := scan.Advance(); tok.TType != TOK_EOF {
+				t.Errorf("For %s expected TOK_EOF, got %v", path, tok)
+			}
+
+			if !errors.Is(scan.Err(), expected) {
+				t.Errorf("For %s expected Err() to be %v, got %v", path, expected, scan.Err())
+			}
+		}
+	}
+}
+
+func TestTokenizeFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.pgs")
+
+	if err := os.WriteFile(path, []byte("x := 1;\ny := 2;\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	scan := NewScanner()
+
+	if err := scan.TokenizeFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	toks := scanAll(scan)
+
+	if len(toks) != 9 || scan.Err() != nil {
+		t.Errorf("Expected 9 tokens without error, got %v (%v)", toks, scan.Err())
+	}
+
+	if scan.Filename() != path || scan.SourceLine(2) != "y := 2;" {
+		t.Errorf("Unexpected filename %q or line %q", scan.Filename(), scan.SourceLine(2))
+	}
+}
+
+func TestTokenPos(t *testing.T) {
+	src := "x := \"héllo\";\n  y"
+
+	scan := NewScanner()
+	scan.Tokenize(src)
+
+	expected := []string{"x", ":=", "\"héllo\"", ";", "y", ""}
+
+	for idx, text := range expected {
+		tok := scan.Next()
+
+		start, end := tok.Pos.Offset(), tok.End().Offset()
+
+		if src[start:end] != text {
+			t.Errorf("At index %d expected %q but pos gives %q", idx, text, src[start:end])
+		}
+	}
+
+	if scan.LastEnd() != scan.File().Pos(len(src)) {
+		t.Errorf("Expected last end at end of input but got %d", scan.LastEnd().Offset())
+	}
+}
+
+func TestFileSet(t *testing.T) {
+	fset := NewFileSet()
+
+	first := NewScanner()
+	first.SetFileSet(fset)
+	first.Tokenize("a\nb")
+
+	second := NewScanner()
+	second.SetFileSet(fset)
+	second.TokenizeReader(iotest.OneByteReader(strings.NewReader("\n\n  c d")))
+
+	firstToks := scanAll(first)
+	secondToks := scanAll(second)
+
+	testMap := map[Pos]string{
+		firstToks[0].Pos:  "1:1",
+		firstToks[1].Pos:  "2:1",
+		secondToks[0].Pos: "3:3",
+		secondToks[1].Pos: "3:5",
+		NoPos:             "-",
+	}
+
+	for pos, expected := range testMap {
+		if fset.Position(pos).String() != expected {
+			t.Errorf("For pos %d expected %s but got %s", pos, expected, fset.Position(pos))
+		}
+	}
+
+	if fset.File(secondToks[0].Pos) != second.File() {
+		t.Error("Expected pos to be in second file")
+	}
+
+	if second.File().Size() != len("\n\n  c d") {
+		t.Errorf("Unexpected file size %d", second.File().Size())
+	}
+}
+
+func TestFileSetReuse(t *testing.T) {
+	scan := NewScanner()
+
+	for i := 0; i < 10; i++ {
+		scan.Tokenize(strings.Repeat("\n", i) + "é x")
+	}
+
+	// same file is replaced rather than another added
+	if scan.File().ID() != 1 || scan.FileSet().File(MakePos(2, 0)) != nil {
+		t.Errorf("Expected only file 1 in set, got file %d", scan.File().ID())
+	}
+
+	toks := scanAll(scan)
+
+	if position := scan.FileSet().Position(toks[1].Pos); position.String() != "10:3" {
+		t.Errorf("Expected x at 10:3 but got %s", position)
+	}
+
+	// differently named input is another file
+	dir := t.TempDir()
+
+	for idx, name := range [...]string{"a.pgs", "b.pgs"} {
+		path := filepath.Join(dir, name)
+
+		if err := os.WriteFile(path, []byte("x"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := scan.TokenizeFile(path); err != nil {
+			t.Fatal(err)
+		}
+
+		if scan.File().ID() != idx+2 || scan.File().Name() != path {
+			t.Errorf("Expected file %d for %s, got %d", idx+2, path, scan.File().ID())
+		}
+	}
+}
+
+func TestFilePositionName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.pgs")
+
+	if err := os.WriteFile(path, []byte("x;\ny;"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	scan := NewScanner()
+
+	if err := scan.TokenizeFile(path); err != nil {
+		t.Fatal(err)
+	}
+
+	toks := scanAll(scan)
+
+	expected := path + ":2:2"
+
+	if scan.FileSet().Position(toks[3].Pos).String() != expected {
+		t.Errorf("Expected %s but got %s", expected, scan.FileSet().Position(toks[3].Pos))
+	}
+}
+
+// line and rune column of byte offset in s
+func lineColumn(s string, offset int) (int, int) {
+	lineStart := strings.LastIndexByte(s[:offset], '\n') + 1
+
+	return strings.Count(s[:offset], "\n") + 1,
+		utf8.RuneCountInString(s[lineStart:offset]) + 1
+}
+
+func TestTokenColumns(t *testing.T) {
+	testMap := map[string][]Token{
+		"if x <= 10 return y;": {
+			{TType: TOK_IF, Line: 1, Column: 1},
+			{TType: TOK_IDENT, Line: 1, Column: 4},
+			{TType: TOK_LE, Line: 1, Column: 6},
+			{TType: TOK_INTEGER, Line: 1, Column: 9},
+			{TType: TOK_RETURN, Line: 1, Column: 12},
+			{TType: TOK_IDENT, Line: 1, Column: 19},
+			{TType: TOK_SEMI, Line: 1, Column: 20},
+			{TType: TOK_EOF, Line: 1, Column: 21},
+		},
+		"é := \"ü\" ** 2;\n\tà.b **= 'ö';": {
+			{TType: TOK_IDENT, Line: 1, Column: 1},
+			{TType: TOK_COLON_EQ, Line: 1, Column: 3},
+			{TType: TOK_STRING, Line: 1, Column: 6},
+			{TType: TOK_STAR_STAR, Line: 1, Column: 10},
+			{TType: TOK_INTEGER, Line: 1, Column: 13},
+			{TType: TOK_SEMI, Line: 1, Column: 14},
+			{TType: TOK_IDENT, Line: 2, Column: 2},
+			{TType: TOK_PERIOD, Line: 2, Column: 3},
+			{TType: TOK_IDENT, Line: 2, Column: 4},
+			{TType: TOK_STAR_STAR_EQ, Line: 2, Column: 6},
+			{TType: TOK_CHAR, Line: 2, Column: 10},
+			{TType: TOK_SEMI, Line: 2, Column: 13},
+		},
+		"/* 日本 */ end 😀": {
+			{TType: TOK_END, Line: 1, Column: 10},
+			{TType: TOK_FAILURE, Line: 1, Column: 14, Text: "😀"},
+		},
+	}
+
+	for s, toks := range testMap {
+		scan := NewScanner()
+
+		scan.Tokenize(s)
+
+		for idx, expected := range toks {
+			tok := scan.Advance()
+
+			if tok.TType != expected.TType ||
+				tok.Line != expected.Line || tok.Column != expected.Column ||
+				(expected.Text != "" && tok.Text != expected.Text) {
+				t.Errorf(
+					"For string %q at index %d expected %v but got %v",
+					s,
+					idx,
+					expected,
+					tok,
+				)
+			}
+		}
+	}
+}
+
+// line and column of every token agree with its offset, and its text with
+// source between its start and end
+func TestTokenPositionsConsistent(t *testing.T) {
+	testStrs := []string{
+		"function f(a : Integer) : Integer begin return a + 1; end;",
+		"x_é := 1.5e3 ** y; // commentaire ünïcode\nz := x << 2 >>= 1;",
+		"struct Ñandú\n\tα : Float = 0.5;\nend struct;",
+		"s := \"héllo {wörld} ✓\" + `raw\n多行` + '\\n';",
+		"q := \"\"\"\n\t  ünï\n\t\"\"\";\nenum É Ä; Ö = 0x1F; end enum;",
+		"/* 😀 /* nested */ */ lambda (a, b) => a != b and not c;",
+		"i++; j--; k ^= ~m; n::o::p[Q](r = 1)",
+	}
+
+	for _, s := range testStrs {
+		scan := NewScanner()
+
+		scan.Tokenize(s)
+
+		for _, tok := range scanAll(scan) {
+			start, end := tok.Pos.Offset(), tok.End().Offset()
+
+			line, column := lineColumn(s, start)
+
+			if tok.Line != line || tok.Column != column {
+				t.Errorf(
+					"For string %q token %v expected at %d:%d",
+					s,
+					tok,
+					line,
+					column,
+				)
+			}
+
+			// resolved position counts runes too
+			position := scan.FileSet().Position(tok.Pos)
+
+			if position.Line != line || position.Column != column {
+				t.Errorf(
+					"For string %q token %v resolved to %s, expected %d:%d",
+					s,
+					tok,
+					position,
+					line,
+					column,
+				)
+			}
+
+			if tok.TType != TOK_EOF && s[start:end] != tok.Text {
+				t.Errorf("For string %q token %v has text %q", s, tok, s[start:end])
+			}
+		}
+	}
+}
+
+func TestFailureTokens(t *testing.T) {
+	testMap := map[string][]Token{
+		"x @ y $ z": {
+			{TType: TOK_IDENT, Text: "x"},
+			{TType: TOK_FAILURE, Text: "@", Reason: "unexpected character '@'"},
+			{TType: TOK_IDENT, Text: "y"},
+			{TType: TOK_FAILURE, Text: "$", Reason: "unexpected character '$'"},
+			{TType: TOK_IDENT, Text: "z"},
+		},
+		"a ! b": {
+			{TType: TOK_IDENT, Text: "a"},
+			{TType: TOK_FAILURE, Text: "!", Reason: "unexpected character '!'"},
+			{TType: TOK_IDENT, Text: "b"},
+		},
+		"a := \"abc\r\nb;": {
+			{TType: TOK_IDENT, Text: "a"},
+			{TType: TOK_COLON_EQ, Text: ":="},
+			{TType: TOK_FAILURE, Text: "\"abc", Reason: REASON_UNTERMINATED_STRING},
+			{TType: TOK_IDENT, Text: "b"},
+			{TType: TOK_SEMI, Text: ";"},
+		},
+		"\"a {x} b\ny": {
+			{TType: TOK_STRING_START, Text: "\"a {"},
+			{TType: TOK_IDENT, Text: "x"},
+			{TType: TOK_FAILURE, Text: "} b", Reason: REASON_UNTERMINATED_STRING},
+			{TType: TOK_IDENT, Text: "y"},
+		},
+		"c := 'x\nd": {
+			{TType: TOK_IDENT, Text: "c"},
+			{TType: TOK_COLON_EQ, Text: ":="},
+			{TType: TOK_FAILURE, Text: "'x", Reason: REASON_UNTERMINATED_CHAR},
+			{TType: TOK_IDENT, Text: "d"},
+		},
+		"0x + 1": {
+			{TType: TOK_FAILURE, Text: "0x", Reason: REASON_MALFORMED_INTEGER},
+			{TType: TOK_PLUS, Text: "+"},
+			{TType: TOK_INTEGER, Text: "1"},
+		},
+		"123abc - 1_000.5": {
+			{TType: TOK_FAILURE, Text: "123abc", Reason: REASON_MALFORMED_INTEGER},
+			{TType: TOK_MINUS, Text: "-"},
+			{TType: TOK_FAILURE, Text: "1_000.5", Reason: REASON_MALFORMED_FLOAT},
+		},
+		"é # /* abc": {
+			{TType: TOK_IDENT, Text: "é"},
+			{TType: TOK_FAILURE, Text: "#", Reason: "unexpected character '#'"},
+			{TType: TOK_FAILURE, Text: "/*", Reason: REASON_UNTERMINATED_COMMENT},
+		},
+	}
+
+	for s, toks := range testMap {
+		scan := NewScanner()
+
+		scan.Tokenize(s)
+
+		for idx, expected := range append(toks, Token{TType: TOK_EOF}) {
+			tok := scan.Advance()
+
+			if tok.TType != expected.TType || tok.Text != expected.Text ||
+				tok.Reason != expected.Reason {
+				t.Errorf(
+					"For string %q at index %d expected %v but got %v",
+					s,
+					idx,
+					expected,
+					tok,
+				)
+			}
+		}
+	}
+}
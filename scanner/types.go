@@ -1,18 +1,84 @@
 package scanner
 
+import (
+	"context"
+	"io"
+	"sync"
+)
+
 type Scanner struct {
+	ctx context.Context
+
+	// error which ended scanning early, guarded by errMutex as pipeline
+	// goroutine may set it (on read error) while it is read by consumer
+	err      error
+	errMutex sync.Mutex
+
+	// nil unless scanner is from NewPipelineScanner
 	tChan *chan Token
 
+	// closed once pipeline goroutine exits
+	pipelineExit chan struct{}
+
+	// set once TOK_EOF is received from pipeline goroutine
+	pipelineDone bool
+	eofTok       Token
+
+	// name of file being scanned (if any) and its contents,
+	// kept to show source in diagnostics
+	filename string
+	src      string
+
+	// line number of first line in src, which is only part of input when
+	// it is read incrementally (guarded by srcMutex as SourceLine may be
+	// called while pipeline goroutine reads more input)
+	srcLine  int
+	srcMutex sync.Mutex
+
+	// byte offset in input of start of src
+	srcBase int
+
+	// registry of files scanned, file is that of current input
+	fset *FileSet
+	file *SourceFile
+
+	// input being read incrementally, nil if input was given as string
+	reader     io.Reader
+	readerDone bool
+
+	// closed once reader is done, e.g. file opened by TokenizeFile
+	closer io.Closer
+
+	// bytes read which end in incomplete UTF-8 sequence,
+	// held back until rest of sequence is read
+	pending []byte
+
+	// byte offset in src of next token to be scanned
+	offset int
+
+	// true => TOK_EOF (or unterminated block comment) reached, nothing more
+	// to scan
+	done bool
+
 	line   int
 	column int
 
-	peek  Token
-	peek2 Token
+	// tokens scanned by Peek/PeekSecond but not yet consumed
+	lookahead []Token
+
+	// end of last token returned by Advance or Next
+	lastEnd Pos
 
-	// filled cached of two tokens (peek, peek2)
-	isCacheFilled bool
+	// true => attach comments and whitespace to tokens
+	keepTrivia bool
 
-	isEof bool
+	// true => doc comments are only returned when asked for,
+	// see SetSkipDocComments
+	skipDoc bool
+
+	// number of interpolated strings whose embedded expression is being
+	// scanned, e.g. 1 after "Hello, {
+	interpDepth int
 }
 
 type Token struct {
@@ -21,6 +87,19 @@ type Token struct {
 	Column int
 	Width  int
 	Text   string
+
+	// start of token, Width bytes from which is its end
+	Pos Pos
+
+	// why scanning failed, only set for TOK_FAILURE,
+	// e.g. "unexpected character '@'"
+	Reason string
+
+	// Comments and whitespace around token, only set if scanner keeps
+	// trivia. Trailing trivia extends up to and including end of token's
+	// line, leading trivia is the rest since the previous token.
+	LeadingTrivia  string
+	TrailingTrivia string
 }
 
 type TokenType int